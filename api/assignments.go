@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ClaimConversation assigns a conversation to the calling agent and pauses the bot
+func ClaimConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok {
+		return
+	}
+	auditBefore(r, conv.AssignmentState())
+
+	me := currentUsername(r)
+	claimed, err := database.ClaimConversation(conv.ID, me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		http.Error(w, "Conversation is already assigned to "+conv.AssignedAgent, http.StatusConflict)
+		return
+	}
+
+	err = database.SetBotActive(conv.ID, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conv.AssignedAgent = me
+	conv.IsBotActive = false
+	audit(r, "conversation.claim", "conversation", conv.ID, conv.AssignmentState())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conv)
+}
+
+// ReleaseConversation unassigns a conversation. Only its agent or an owner may release it.
+func ReleaseConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok || !canReassign(w, r, conv) {
+		return
+	}
+	auditBefore(r, conv.AssignmentState())
+
+	err := database.AssignConversation(conv.ID, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conv.AssignedAgent = ""
+	audit(r, "conversation.release", "conversation", conv.ID, conv.AssignmentState())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conv)
+}
+
+// TransferConversation hands a conversation to another agent. Only its agent or an
+// owner may transfer it; unassigned conversations can be handed out by any agent.
+func TransferConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok || !canReassign(w, r, conv) {
+		return
+	}
+
+	var req struct {
+		Agent string `json:"agent"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	agent, err := database.GetAdminUserByUsername(req.Agent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if agent == nil {
+		http.Error(w, "User not found", http.StatusBadRequest)
+		return
+	}
+	if !agent.HasRole(database.RoleAgent) {
+		http.Error(w, agent.Username+" is a viewer and cannot handle conversations", http.StatusBadRequest)
+		return
+	}
+	auditBefore(r, conv.AssignmentState())
+
+	err = database.AssignConversation(conv.ID, agent.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Conversation %d transferred to %q by %q", conv.ID, agent.Username, currentUsername(r))
+
+	conv.AssignedAgent = agent.Username
+	audit(r, "conversation.transfer", "conversation", conv.ID, conv.AssignmentState())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conv)
+}
+
+// canReassign checks that the caller may release or transfer a conversation, writing
+// an error response if not
+func canReassign(w http.ResponseWriter, r *http.Request, conv *database.Conversation) bool {
+	me := currentUser(r)
+	if conv.AssignedAgent == "" || conv.AssignedAgent == me.Username || me.HasRole(database.RoleOwner) {
+		return true
+	}
+
+	http.Error(w, "Conversation is assigned to "+conv.AssignedAgent, http.StatusForbidden)
+	return false
+}
+
+// loadConversation reads the {id} URL parameter and loads the conversation, writing an error response on failure
+func loadConversation(w http.ResponseWriter, r *http.Request) (*database.Conversation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	conv, err := database.GetConversation(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if conv == nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return conv, true
+}
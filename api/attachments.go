@@ -0,0 +1,165 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"telecust/bot"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetAttachmentFile serves an attachment, downloading it from Telegram the first time
+func GetAttachmentFile(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	att, err := database.GetAttachment(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if att == nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	// Download on demand, and again if the local copy was removed
+	if _, statErr := os.Stat(att.LocalPath); att.LocalPath == "" || statErr != nil {
+		if bot.GlobalBot == nil {
+			http.Error(w, "Bot not initialized", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = bot.GlobalBot.DownloadAttachment(att)
+		if err != nil {
+			log.Printf("Error downloading attachment %d: %v", att.ID, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	// Files come from customers, so only plain images are shown inline. Everything else
+	// is downloaded, and nothing served here may run script on the dashboard origin.
+	contentType := attachmentContentType(att)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition(contentType, att.FileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeFile(w, r, att.LocalPath)
+}
+
+// inlineImageTypes are the attachment types the dashboard may display inline
+var inlineImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// attachmentContentType is the type an attachment is served with. Telegram photos
+// carry no type and are always JPEG; other files without one are served as bytes
+// rather than by the extension of their local copy.
+func attachmentContentType(att *database.Attachment) string {
+	switch {
+	case att.MimeType != "":
+		return att.MimeType
+	case att.Kind == database.AttachmentPhoto:
+		return "image/jpeg"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// attachmentDisposition builds the Content-Disposition header of an attachment
+func attachmentDisposition(contentType, fileName string) string {
+	disposition := "attachment"
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && inlineImageTypes[mediaType] {
+		disposition = "inline"
+	}
+	if fileName == "" {
+		return disposition
+	}
+
+	header := mime.FormatMediaType(disposition, map[string]string{"filename": fileName})
+	if header == "" {
+		return disposition
+	}
+	return header
+}
+
+// Telegram's upload limits for bots
+const (
+	maxPhotoUpload    = 10 << 20
+	maxDocumentUpload = 50 << 20
+)
+
+// fileUpload is a file an admin uploaded to send to a customer
+type fileUpload struct {
+	Name string
+	Kind string // 'photo' or 'document'
+	Data []byte
+}
+
+// readFileUpload reads the "file" field of a multipart request. Common image types
+// are sent as photos unless "kind" is "document" or they are too large for a photo.
+func readFileUpload(w http.ResponseWriter, r *http.Request) (*fileUpload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentUpload+1<<20)
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload: %v", err)
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("file is required")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if len(data) > maxDocumentUpload {
+		return nil, fmt.Errorf("file is larger than 50 MB")
+	}
+
+	upload := &fileUpload{Name: filepath.Base(header.Filename), Data: data}
+
+	switch r.FormValue("kind") {
+	case database.AttachmentPhoto:
+		if len(data) > maxPhotoUpload {
+			return nil, fmt.Errorf("photos must be 10 MB or smaller, send it as a document instead")
+		}
+		upload.Kind = database.AttachmentPhoto
+	case database.AttachmentDocument:
+		upload.Kind = database.AttachmentDocument
+	case "":
+		switch http.DetectContentType(data) {
+		case "image/jpeg", "image/png", "image/webp":
+			if len(data) <= maxPhotoUpload {
+				upload.Kind = database.AttachmentPhoto
+			} else {
+				upload.Kind = database.AttachmentDocument
+			}
+		default:
+			upload.Kind = database.AttachmentDocument
+		}
+	default:
+		return nil, fmt.Errorf("kind must be photo or document")
+	}
+
+	return upload, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"telecust/database"
+	"testing"
+)
+
+func TestAttachmentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		fileName    string
+		want        string
+	}{
+		{"image inline", "image/png", "photo.png", `inline; filename=photo.png`},
+		{"image with parameters", "image/jpeg; q=1", "", "inline"},
+		{"html downloaded", "text/html", "invoice.html", `attachment; filename=invoice.html`},
+		{"svg downloaded", "image/svg+xml", "logo.svg", `attachment; filename=logo.svg`},
+		{"invalid type downloaded", "not a type", "", "attachment"},
+		{"quoted name", "application/pdf", `a "b".pdf`, `attachment; filename="a \"b\".pdf"`},
+		{"non-ASCII name", "application/pdf", "harga é.pdf", `attachment; filename*=utf-8''harga%20%C3%A9.pdf`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attachmentDisposition(tt.contentType, tt.fileName); got != tt.want {
+				t.Errorf("attachmentDisposition(%q, %q) = %s, want %s", tt.contentType, tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	tests := []struct {
+		att  database.Attachment
+		want string
+	}{
+		{database.Attachment{Kind: database.AttachmentDocument, MimeType: "text/html"}, "text/html"},
+		{database.Attachment{Kind: database.AttachmentPhoto}, "image/jpeg"},
+		{database.Attachment{Kind: database.AttachmentDocument}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		if got := attachmentContentType(&tt.att); got != tt.want {
+			t.Errorf("attachmentContentType(%+v) = %s, want %s", tt.att, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"telecust/database"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const auditContextKey contextKey = "audit"
+
+// auditRecord collects what a handler changed, to be logged once it responds
+type auditRecord struct {
+	action     string
+	targetType string
+	targetID   string
+	before     string
+	after      string
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// auditMiddleware logs every POST, PUT and DELETE request, including refused ones.
+// Handlers name the action and describe the change with auditBefore and audit;
+// otherwise the method and route are logged.
+func auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &auditRecord{}
+		sw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditContextKey, rec)))
+
+		if rec.action == "" {
+			rec.action = r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+			rec.targetID = chi.URLParam(r, "id")
+		}
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		saveAudit(r, currentUsername(r), rec, sw.status)
+	})
+}
+
+// auditBefore snapshots the target before a handler changes it
+func auditBefore(r *http.Request, before interface{}) {
+	if rec, ok := r.Context().Value(auditContextKey).(*auditRecord); ok {
+		rec.before = database.AuditJSON(before)
+	}
+}
+
+// audit names the change a handler made and snapshots the target afterwards
+func audit(r *http.Request, action, targetType string, targetID interface{}, after interface{}) {
+	if rec, ok := r.Context().Value(auditContextKey).(*auditRecord); ok {
+		rec.action = action
+		rec.targetType = targetType
+		rec.targetID = fmt.Sprint(targetID)
+		rec.after = database.AuditJSON(after)
+	}
+}
+
+// saveAudit stores an audit entry. Failures are logged rather than failing the
+// request, which has already been answered.
+func saveAudit(r *http.Request, actor string, rec *auditRecord, status int) {
+	entry := &database.AuditEntry{
+		Actor:      actor,
+		Action:     rec.action,
+		TargetType: rec.targetType,
+		TargetID:   rec.targetID,
+		Before:     rec.before,
+		After:      rec.after,
+		Status:     status,
+		IP:         clientIP(r),
+	}
+
+	if err := database.SaveAuditEntry(entry); err != nil {
+		log.Printf("Error saving audit entry %q by %q: %v", entry.Action, entry.Actor, err)
+	}
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only believed when
+// TRUST_PROXY is set, since clients can send it themselves.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ListAuditEntries returns audit log entries, newest first. Optional query
+// parameters: actor, action (or a prefix such as "document."), target_type,
+// target_id, since and until (RFC 3339 or YYYY-MM-DD), limit (default 100, max 1000).
+func ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.AuditFilter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(q.Get("since"), false); err != nil {
+		http.Error(w, "Invalid 'since' time", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseAuditTime(q.Get("until"), true); err != nil {
+		http.Error(w, "Invalid 'until' time", http.StatusBadRequest)
+		return
+	}
+
+	filter.Limit, err = strconv.Atoi(q.Get("limit"))
+	if err != nil || filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	if filter.Limit > 1000 {
+		filter.Limit = 1000
+	}
+
+	entries, err := database.ListAuditEntries(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// parseAuditTime parses an RFC 3339 time or a date. A date used as an upper bound
+// means the end of that day.
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,125 @@
+package api
+
+import "strings"
+
+// maxDiffCells bounds the work of a diff: when the changed middle of two texts has more
+// line pairs than this, it is shown as fully replaced instead of compared line by line
+const maxDiffCells = 16 << 20
+
+// DiffLine is one line of a line-based diff
+type DiffLine struct {
+	Type string `json:"type"` // 'equal', 'insert', 'delete'
+	Text string `json:"text"`
+}
+
+// diffLines compares two texts line by line using the longest common subsequence.
+// It uses Hirschberg's algorithm, so memory grows with the length of the texts rather
+// than with their product.
+func diffLines(from, to string) []DiffLine {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// Lines shared at the start and end need no comparing
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := []DiffLine{}
+	lines = appendLines(lines, "equal", a[:prefix])
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		lines = appendLines(lines, "delete", midA)
+		lines = appendLines(lines, "insert", midB)
+	} else {
+		lines = hirschberg(lines, midA, midB)
+	}
+
+	return appendLines(lines, "equal", a[len(a)-suffix:])
+}
+
+// hirschberg appends the diff of a and b, splitting a in half and b where the halves'
+// longest common subsequences meet
+func hirschberg(lines []DiffLine, a, b []string) []DiffLine {
+	switch {
+	case len(a) == 0:
+		return appendLines(lines, "insert", b)
+	case len(b) == 0:
+		return appendLines(lines, "delete", a)
+	case len(a) == 1:
+		for j, line := range b {
+			if line == a[0] {
+				lines = appendLines(lines, "insert", b[:j])
+				lines = append(lines, DiffLine{Type: "equal", Text: line})
+				return appendLines(lines, "insert", b[j+1:])
+			}
+		}
+		lines = append(lines, DiffLine{Type: "delete", Text: a[0]})
+		return appendLines(lines, "insert", b)
+	}
+
+	mid := len(a) / 2
+	forward := lcsRow(a[:mid], b, false)
+	backward := lcsRow(a[mid:], b, true)
+
+	split, best := 0, -1
+	for j := 0; j <= len(b); j++ {
+		if score := forward[j] + backward[len(b)-j]; score > best {
+			split, best = j, score
+		}
+	}
+
+	lines = hirschberg(lines, a[:mid], b[:split])
+	return hirschberg(lines, a[mid:], b[split:])
+}
+
+// lcsRow returns, for every j, the LCS length of a and the first j lines of b, or with
+// reverse set, of a and the last j lines of b. Only two rows are kept in memory.
+func lcsRow(a, b []string, reverse bool) []int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for i := range a {
+		x := a[i]
+		if reverse {
+			x = a[len(a)-1-i]
+		}
+		for j := 1; j <= len(b); j++ {
+			y := b[j-1]
+			if reverse {
+				y = b[len(b)-j]
+			}
+
+			switch {
+			case x == y:
+				curr[j] = prev[j-1] + 1
+			case prev[j] >= curr[j-1]:
+				curr[j] = prev[j]
+			default:
+				curr[j] = curr[j-1]
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev
+}
+
+func appendLines(lines []DiffLine, kind string, texts []string) []DiffLine {
+	for _, text := range texts {
+		lines = append(lines, DiffLine{Type: kind, Text: text})
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string // One line per DiffLine: ' ' equal, '+' insert, '-' delete
+	}{
+		{"both empty", "", "", ""},
+		{"added text", "", "a\nb", "+a\n+b"},
+		{"removed text", "a\nb", "", "-a\n-b"},
+		{"unchanged", "a\nb", "a\nb", " a\n b"},
+		{"changed line", "a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c"},
+		{"inserted line", "a\nc", "a\nb\nc", " a\n+b\n c"},
+		{"deleted line", "a\nb\nc", "a\nc", " a\n-b\n c"},
+		{"windows line endings", "a\r\nb", "a\nb", " a\n b"},
+		{"moved line", "a\nb\nc\nd", "b\nc\nd\na", "-a\n b\n c\n d\n+a"},
+		{"interleaved", "a\nb\nc\nd\ne", "a\nc\nx\ne\nf", " a\n-b\n c\n-d\n+x\n e\n+f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range diffLines(tt.from, tt.to) {
+				got = append(got, map[string]string{"equal": " ", "insert": "+", "delete": "-"}[line.Type]+line.Text)
+			}
+			if strings.Join(got, "\n") != tt.want {
+				t.Errorf("diffLines:\n%s\nwant:\n%s", strings.Join(got, "\n"), tt.want)
+			}
+		})
+	}
+}
+
+// A large diff must keep the lines of both texts: everything in from is kept or
+// deleted and everything in to is kept or inserted, in order
+func TestDiffLinesLarge(t *testing.T) {
+	var from, to []string
+	for i := 0; i < 5000; i++ {
+		from = append(from, strings.Repeat("x", i%7)+string(rune('a'+i%26)))
+		if i%3 != 0 {
+			to = append(to, strings.Repeat("y", i%5)+string(rune('a'+i%26)))
+		}
+	}
+
+	var gotFrom, gotTo []string
+	for _, line := range diffLines(strings.Join(from, "\n"), strings.Join(to, "\n")) {
+		if line.Type != "insert" {
+			gotFrom = append(gotFrom, line.Text)
+		}
+		if line.Type != "delete" {
+			gotTo = append(gotTo, line.Text)
+		}
+	}
+
+	if strings.Join(gotFrom, "\n") != strings.Join(from, "\n") {
+		t.Error("diff does not reproduce the old text")
+	}
+	if strings.Join(gotTo, "\n") != strings.Join(to, "\n") {
+		t.Error("diff does not reproduce the new text")
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"telecust/events"
+	"time"
+)
+
+// sseHeartbeat keeps idle event streams open through proxies
+const sseHeartbeat = 25 * time.Second
+
+// StreamEvents pushes dashboard updates (new messages, bot takeovers, knowledge base
+// changes) as Server-Sent Events until the client disconnects
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+
+	// Ask the browser to reconnect quickly if the stream drops
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	log.Printf("[EVENTS] Dashboard connected from %s", r.RemoteAddr)
+	defer log.Printf("[EVENTS] Dashboard disconnected from %s", r.RemoteAddr)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("[EVENTS] Error encoding %s event: %v", event.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -2,17 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"telecust/bot"
 	"telecust/database"
+	"telecust/events"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/gorilla/sessions"
 )
 
-// GetConversations returns all conversations
+// GetConversations returns all conversations. The optional filter query parameter
+// narrows them to "mine" (assigned to the caller), "unassigned" (bot paused, no
+// agent) or "bot" (handled by the bot).
 func GetConversations(w http.ResponseWriter, r *http.Request) {
 	conversations, err := database.GetAllConversations()
 	if err != nil {
@@ -20,6 +25,31 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var keep func(c *database.Conversation) bool
+	switch filter := r.URL.Query().Get("filter"); filter {
+	case "":
+	case "mine":
+		me := currentUsername(r)
+		keep = func(c *database.Conversation) bool { return c.AssignedAgent == me }
+	case "unassigned":
+		keep = func(c *database.Conversation) bool { return !c.IsBotActive && c.AssignedAgent == "" }
+	case "bot":
+		keep = func(c *database.Conversation) bool { return c.IsBotActive }
+	default:
+		http.Error(w, "Invalid filter, use mine, unassigned or bot", http.StatusBadRequest)
+		return
+	}
+
+	if keep != nil {
+		filtered := []database.Conversation{}
+		for i := range conversations {
+			if keep(&conversations[i]) {
+				filtered = append(filtered, conversations[i])
+			}
+		}
+		conversations = filtered
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(conversations)
 }
@@ -43,8 +73,8 @@ func GetConversationMessages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(messages)
 }
 
-// TakeOverConversation disables bot for a conversation
-func TakeOverConversation(w http.ResponseWriter, r *http.Request) {
+// GetConversationToolCalls returns the tools the AI called in a conversation
+func GetConversationToolCalls(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -52,18 +82,22 @@ func TakeOverConversation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.SetBotActive(id, false)
+	calls, err := database.GetToolCalls(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if calls == nil {
+		calls = []database.ToolCallLog{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(calls)
 }
 
-// ActivateBot enables bot for a conversation
-func ActivateBot(w http.ResponseWriter, r *http.Request) {
+// GetConversationEvents returns non-message events of a conversation, such as button presses
+func GetConversationEvents(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -71,39 +105,159 @@ func ActivateBot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.SetBotActive(id, true)
+	events, err := database.GetConversationEvents(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if events == nil {
+		events = []database.ConversationEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// TakeOverConversation disables bot for a conversation and assigns it to the caller
+// if nobody has it yet
+func TakeOverConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok {
+		return
+	}
+	auditBefore(r, conv.AssignmentState())
+
+	err := database.SetBotActive(conv.ID, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conv.IsBotActive = false
+
+	if conv.AssignedAgent == "" {
+		claimed, err := database.ClaimConversation(conv.ID, currentUsername(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if claimed {
+			conv.AssignedAgent = currentUsername(r)
+		}
+	}
+
+	audit(r, "conversation.takeover", "conversation", conv.ID, conv.AssignmentState())
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// SendMessage sends a message from admin to user
-func SendMessage(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+// ActivateBot enables bot for a conversation and releases it from its agent
+func ActivateBot(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok {
+		return
+	}
+	auditBefore(r, conv.AssignmentState())
+
+	err := database.SetBotActive(conv.ID, true)
 	if err != nil {
-		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conv.IsBotActive = true
+
+	if conv.AssignedAgent != "" {
+		err = database.AssignConversation(conv.ID, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conv.AssignedAgent = ""
+	}
+
+	audit(r, "conversation.activate_bot", "conversation", conv.ID, conv.AssignmentState())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// maxTakeoverTimeout is the longest takeover timeout that can be set, one week in minutes
+const maxTakeoverTimeout = 7 * 24 * 60
+
+// SetTakeoverTimeout sets how long the bot stays paused in a conversation without an
+// admin message. The body is {"minutes": n}; null uses TAKEOVER_TIMEOUT_MINUTES and 0
+// keeps the bot paused until someone activates it.
+func SetTakeoverTimeout(w http.ResponseWriter, r *http.Request) {
+	conv, ok := loadConversation(w, r)
+	if !ok {
 		return
 	}
 
 	var req struct {
-		Message string `json:"message"`
+		Minutes *int `json:"minutes"`
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Message == "" {
-		http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+	if req.Minutes != nil && (*req.Minutes < 0 || *req.Minutes > maxTakeoverTimeout) {
+		http.Error(w, fmt.Sprintf("Minutes must be between 0 and %d", maxTakeoverTimeout), http.StatusBadRequest)
 		return
 	}
+	auditBefore(r, map[string]*int{"takeover_timeout": conv.TakeoverTimeout})
+
+	err = database.SetTakeoverTimeout(conv.ID, req.Minutes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conv.TakeoverTimeout = req.Minutes
+	audit(r, "conversation.takeover_timeout", "conversation", conv.ID, map[string]*int{"takeover_timeout": conv.TakeoverTimeout})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conv)
+}
+
+// SendMessage sends a message from admin to user. A JSON body sends text; a
+// multipart/form-data body with a "file" field sends a photo or document, using
+// "message" as the caption.
+func SendMessage(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	var upload *fileUpload
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		upload, err = readFileUpload(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Message = strings.TrimSpace(r.FormValue("message"))
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Message == "" {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Get conversation to find chat ID
 	conversations, err := database.GetAllConversations()
@@ -133,13 +287,30 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bot.GlobalBot.SendMessageAsAdmin(chatID, req.Message, id)
+	if upload != nil {
+		att, err := bot.GlobalBot.SendFileAsAdmin(chatID, id, currentUsername(r), upload.Kind, upload.Name, upload.Data, req.Message)
+		if err != nil {
+			log.Printf("Error sending file: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		audit(r, "message.send", "conversation", id, map[string]interface{}{"message": req.Message, "attachment": att})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(att)
+		return
+	}
+
+	err = bot.GlobalBot.SendMessageAsAdmin(chatID, req.Message, id, currentUsername(r))
 	if err != nil {
 		log.Printf("Error sending message: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	audit(r, "message.send", "conversation", id, map[string]string{"message": req.Message})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
@@ -168,18 +339,344 @@ func UpdateKnowledgeBase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.UpdateKnowledgeBase(req.Content)
+	if before, err := database.GetKnowledgeBase(); err == nil {
+		auditBefore(r, map[string]string{"content": before})
+	}
+
+	err = database.UpdateKnowledgeBase(req.Content, currentUsername(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "knowledge_base.update", "knowledge_base", "", map[string]string{"content": req.Content})
+
+	knowledgeBaseChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// knowledgeBaseChanged notifies dashboards and refreshes retrieval chunks in the
+// background after a knowledge base change
+func knowledgeBaseChanged() {
+	events.Publish(events.Event{Type: events.KnowledgeBaseChanged})
+
+	go func() {
+		if err := bot.ReindexKnowledgeBase(); err != nil {
+			log.Printf("Error reindexing knowledge base: %v", err)
+		}
+	}()
+}
+
+// knowledgeDocumentRequest is the body for creating or updating a document
+type knowledgeDocumentRequest struct {
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Enabled  *bool  `json:"enabled"`
+	Content  string `json:"content"`
+}
+
+// ListKnowledgeDocuments returns all knowledge base documents
+func ListKnowledgeDocuments(w http.ResponseWriter, r *http.Request) {
+	docs, err := database.ListKnowledgeDocuments()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if docs == nil {
+		docs = []database.KnowledgeBase{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(docs)
+}
+
+// GetKnowledgeDocument returns a single knowledge base document
+func GetKnowledgeDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := database.GetKnowledgeDocument(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if doc == nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// CreateKnowledgeDocument adds a knowledge base document
+func CreateKnowledgeDocument(w http.ResponseWriter, r *http.Request) {
+	var req knowledgeDocumentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Title and content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	doc := &database.KnowledgeBase{
+		Title:    strings.TrimSpace(req.Title),
+		Category: strings.TrimSpace(req.Category),
+		Enabled:  req.Enabled == nil || *req.Enabled,
+		Content:  req.Content,
+	}
+
+	err = database.CreateKnowledgeDocument(doc, currentUsername(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "document.create", "document", doc.ID, doc)
+
+	knowledgeBaseChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// UpdateKnowledgeDocument edits a knowledge base document
+func UpdateKnowledgeDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	var req knowledgeDocumentRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Title and content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := database.GetKnowledgeDocument(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if doc == nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	auditBefore(r, doc)
+
+	doc.Title = strings.TrimSpace(req.Title)
+	doc.Category = strings.TrimSpace(req.Category)
+	doc.Content = req.Content
+	if req.Enabled != nil {
+		doc.Enabled = *req.Enabled
+	}
+
+	err = database.UpdateKnowledgeDocument(doc, currentUsername(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "document.update", "document", doc.ID, doc)
+
+	knowledgeBaseChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// DeleteKnowledgeDocument removes a knowledge base document
+func DeleteKnowledgeDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := database.GetKnowledgeDocument(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if doc == nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	auditBefore(r, doc)
+
+	err = database.DeleteKnowledgeDocument(doc, currentUsername(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "document.delete", "document", doc.ID, nil)
+
+	knowledgeBaseChanged()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// Session store
-var store = sessions.NewCookieStore([]byte("telecust-secret-key-change-in-production"))
+// ListKnowledgeRevisions returns knowledge base revisions, newest first.
+// Optional query parameters: document_id, limit (default 50).
+func ListKnowledgeRevisions(w http.ResponseWriter, r *http.Request) {
+	documentID, _ := strconv.Atoi(r.URL.Query().Get("document_id"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	revisions, err := database.ListKnowledgeRevisions(documentID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if revisions == nil {
+		revisions = []database.KnowledgeRevision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetKnowledgeRevision returns a single revision with its full content
+func GetKnowledgeRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	rev, err := database.GetKnowledgeRevision(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rev == nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// DiffKnowledgeRevisions returns a line diff between two revisions.
+// Query parameters: to (required) and from (defaults to the previous revision of the same document).
+func DiffKnowledgeRevisions(w http.ResponseWriter, r *http.Request) {
+	toID, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid 'to' revision ID", http.StatusBadRequest)
+		return
+	}
+
+	to, err := database.GetKnowledgeRevision(toID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if to == nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	var from *database.KnowledgeRevision
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		fromID, err := strconv.Atoi(fromStr)
+		if err != nil {
+			http.Error(w, "Invalid 'from' revision ID", http.StatusBadRequest)
+			return
+		}
+		from, err = database.GetKnowledgeRevision(fromID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if from == nil {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		from, err = database.GetPreviousKnowledgeRevision(to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	fromContent := ""
+	if from != nil {
+		fromContent = from.Content
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":  from,
+		"to":    to,
+		"lines": diffLines(fromContent, to.Content),
+	})
+}
+
+// RestoreKnowledgeRevision rolls a document back to a previous revision
+func RestoreKnowledgeRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	rev, err := database.GetKnowledgeRevision(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rev == nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if rev.Action == database.RevisionDelete {
+		http.Error(w, "Cannot restore a deletion, pick an earlier revision", http.StatusBadRequest)
+		return
+	}
+
+	if before, err := database.GetKnowledgeDocument(rev.DocumentID); err == nil && before != nil {
+		auditBefore(r, before)
+	}
+
+	doc, err := database.RestoreKnowledgeRevision(id, currentUsername(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "document.restore", "document", doc.ID, doc)
+
+	knowledgeBaseChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
 
 // Login handles user authentication
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -196,17 +693,31 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Simple hardcoded authentication
-	if req.Username == "admin" && req.Password == "vibedemo" {
+	user, err := database.AuthenticateAdmin(req.Username, req.Password)
+	if err != nil {
+		log.Printf("Error checking login for %q: %v", req.Username, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login failed"})
+		return
+	}
+
+	if user != nil {
 		session, _ := store.Get(r, "auth-session")
 		session.Values["authenticated"] = true
+		session.Values["user_id"] = user.ID
+		session.Values["username"] = user.Username
 		session.Save(r, w)
 
+		saveAudit(r, user.Username, &auditRecord{action: "auth.login", targetType: "user", targetID: strconv.Itoa(user.ID)}, http.StatusOK)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 		return
 	}
 
+	saveAudit(r, req.Username, &auditRecord{action: "auth.login_failed"}, http.StatusUnauthorized)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusUnauthorized)
 	json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
@@ -214,6 +725,10 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 // Logout handles user logout
 func Logout(w http.ResponseWriter, r *http.Request) {
+	if user := sessionUser(r); user != nil {
+		saveAudit(r, user.Username, &auditRecord{action: "auth.logout", targetType: "user", targetID: strconv.Itoa(user.ID)}, http.StatusOK)
+	}
+
 	session, _ := store.Get(r, "auth-session")
 	session.Values["authenticated"] = false
 	session.Options.MaxAge = -1
@@ -223,17 +738,29 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// AuthMiddleware checks if user is authenticated
+// currentUsername returns the username of the logged in admin
+func currentUsername(r *http.Request) string {
+	if user := currentUser(r); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// AuthMiddleware checks if user is authenticated. Logged out visitors are sent to the
+// login page, which returns them to the page they asked for, e.g. a conversation link.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, _ := store.Get(r, "auth-session")
-
 		// Check if user is authenticated
-		if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
-			http.Redirect(w, r, "/login.html", http.StatusSeeOther)
+		user := sessionUser(r)
+		if user == nil {
+			target := "/login.html"
+			if r.URL.RequestURI() != "/" {
+				target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withUser(r, user))
 	})
 }
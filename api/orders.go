@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListOrders returns orders, optionally filtered with ?status= and ?conversation_id=
+func ListOrders(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !database.ValidOrderStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	conversationID := 0
+	if idStr := r.URL.Query().Get("conversation_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+		conversationID = id
+	}
+
+	writeOrders(w, status, conversationID)
+}
+
+// GetConversationOrders returns the orders placed in a conversation
+func GetConversationOrders(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	writeOrders(w, "", id)
+}
+
+func writeOrders(w http.ResponseWriter, status string, conversationID int) {
+	orders, err := database.ListOrders(status, conversationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if orders == nil {
+		orders = []database.Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetOrder returns a single order with its items
+func GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := loadOrder(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// UpdateOrderStatus changes an order's status, e.g. to mark it completed
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	order, ok := loadOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !database.ValidOrderStatus(req.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	auditBefore(r, map[string]string{"status": order.Status})
+
+	err = database.SetOrderStatus(order.ID, req.Status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "order.status", "order", order.ID, map[string]string{"status": req.Status})
+
+	order, err = database.GetOrder(order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// loadOrder reads the {id} URL parameter and loads the order, writing an error response on failure
+func loadOrder(w http.ResponseWriter, r *http.Request) (*database.Order, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	order, err := database.GetOrder(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if order == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return order, true
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// productRequest is the body for creating or updating a product
+type productRequest struct {
+	Name      string               `json:"name"`
+	Aliases   string               `json:"aliases"`
+	Unit      string               `json:"unit"`
+	BasePrice int64                `json:"base_price"`
+	Enabled   *bool                `json:"enabled"`
+	Tiers     []database.PriceTier `json:"tiers"`
+}
+
+func (req *productRequest) apply(p *database.Product) {
+	p.Name = strings.TrimSpace(req.Name)
+	p.Aliases = strings.TrimSpace(req.Aliases)
+	p.Unit = strings.TrimSpace(req.Unit)
+	if p.Unit == "" {
+		p.Unit = "bungkus"
+	}
+	p.BasePrice = req.BasePrice
+	if req.Enabled != nil {
+		p.Enabled = *req.Enabled
+	}
+	p.Tiers = req.Tiers
+	if p.Tiers == nil {
+		p.Tiers = []database.PriceTier{}
+	}
+}
+
+// ListProducts returns the product catalog
+func ListProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := database.ListProducts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if products == nil {
+		products = []database.Product{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// GetProduct returns a single product with its price tiers
+func GetProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// CreateProduct adds a product to the catalog
+func CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var req productRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product := &database.Product{Enabled: true}
+	req.apply(product)
+
+	if err := product.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.CreateProduct(product)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "product.create", "product", product.ID, product)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// UpdateProduct edits a product and replaces its price tiers
+func UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	var req productRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	auditBefore(r, product)
+	req.apply(product)
+
+	if err := product.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.UpdateProduct(product)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "product.update", "product", product.ID, product)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// DeleteProduct removes a product from the catalog
+func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	auditBefore(r, product)
+
+	err := database.DeleteProduct(product.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "product.delete", "product", product.ID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// QuoteProduct prices a quantity of a product, e.g. GET /api/products/1/quote?quantity=20
+func QuoteProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.URL.Query().Get("quantity"))
+	if err != nil || quantity <= 0 {
+		http.Error(w, "Invalid quantity", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := product.Quote(quantity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// loadProduct reads the {id} URL parameter and loads the product, writing an error response on failure
+func loadProduct(w http.ResponseWriter, r *http.Request) (*database.Product, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	product, err := database.GetProduct(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if product == nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return product, true
+}
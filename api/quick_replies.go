@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// quickReplyRequest is the body for creating or updating a quick-reply button
+type quickReplyRequest struct {
+	Label    string `json:"label"`
+	Action   string `json:"action"`
+	Payload  string `json:"payload"`
+	ShowOn   string `json:"show_on"`
+	Position int    `json:"position"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func (req *quickReplyRequest) apply(q *database.QuickReply) {
+	q.Label = strings.TrimSpace(req.Label)
+	q.Action = req.Action
+	if q.Action == "" {
+		q.Action = database.QuickReplyMessage
+	}
+	q.Payload = strings.TrimSpace(req.Payload)
+	q.ShowOn = req.ShowOn
+	if q.ShowOn == "" {
+		q.ShowOn = database.ShowOnStart
+	}
+	q.Position = req.Position
+	if req.Enabled != nil {
+		q.Enabled = *req.Enabled
+	}
+}
+
+// ListQuickReplies returns all quick-reply buttons
+func ListQuickReplies(w http.ResponseWriter, r *http.Request) {
+	replies, err := database.ListQuickReplies()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if replies == nil {
+		replies = []database.QuickReply{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replies)
+}
+
+// CreateQuickReply adds a quick-reply button
+func CreateQuickReply(w http.ResponseWriter, r *http.Request) {
+	var req quickReplyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	reply := &database.QuickReply{Enabled: true}
+	req.apply(reply)
+
+	if err := reply.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.CreateQuickReply(reply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "quick_reply.create", "quick_reply", reply.ID, reply)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reply)
+}
+
+// UpdateQuickReply edits a quick-reply button
+func UpdateQuickReply(w http.ResponseWriter, r *http.Request) {
+	reply, ok := loadQuickReply(w, r)
+	if !ok {
+		return
+	}
+
+	var req quickReplyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	auditBefore(r, reply)
+	req.apply(reply)
+
+	if err := reply.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.UpdateQuickReply(reply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "quick_reply.update", "quick_reply", reply.ID, reply)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+// DeleteQuickReply removes a quick-reply button
+func DeleteQuickReply(w http.ResponseWriter, r *http.Request) {
+	reply, ok := loadQuickReply(w, r)
+	if !ok {
+		return
+	}
+
+	auditBefore(r, reply)
+
+	err := database.DeleteQuickReply(reply.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "quick_reply.delete", "quick_reply", reply.ID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// loadQuickReply reads the {id} URL parameter and loads the quick reply, writing an error response on failure
+func loadQuickReply(w http.ResponseWriter, r *http.Request) (*database.QuickReply, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid quick reply ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	reply, err := database.GetQuickReply(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if reply == nil {
+		http.Error(w, "Quick reply not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return reply, true
+}
@@ -5,12 +5,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"telecust/bot"
+	"telecust/database"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 )
 
 func StartServer() {
+	initSessionStore()
+
 	r := chi.NewRouter()
 
 	// Middleware
@@ -29,28 +33,77 @@ func StartServer() {
 		http.ServeFile(w, r, "./web/login.html")
 	}))
 
+	// Telegram webhook, authenticated by its secret token header instead of a session
+	if bot.GlobalBot != nil && bot.GlobalBot.WebhookEnabled() {
+		r.Post(bot.WebhookPath, bot.GlobalBot.HandleWebhook)
+	}
+
 	// Protected API routes (auth required)
 	r.Route("/api", func(r chi.Router) {
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				session, _ := store.Get(r, "auth-session")
-				if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
+				user := sessionUser(r)
+				if user == nil {
 					w.Header().Set("Content-Type", "application/json")
 					w.WriteHeader(http.StatusUnauthorized)
 					json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
 					return
 				}
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, withUser(r, user))
 			})
 		})
+		r.Use(auditMiddleware)
+
+		// Every role can read; replying needs agent, configuration needs owner
+		agent := requireRole(database.RoleAgent)
+		owner := requireRole(database.RoleOwner)
 
+		r.Get("/events", StreamEvents)
 		r.Get("/conversations", GetConversations)
 		r.Get("/conversations/{id}/messages", GetConversationMessages)
-		r.Post("/conversations/{id}/takeover", TakeOverConversation)
-		r.Post("/conversations/{id}/activate-bot", ActivateBot)
-		r.Post("/conversations/{id}/send", SendMessage)
+		r.Get("/conversations/{id}/tool-calls", GetConversationToolCalls)
+		r.Get("/conversations/{id}/orders", GetConversationOrders)
+		r.Get("/conversations/{id}/events", GetConversationEvents)
+		r.Get("/attachments/{id}/file", GetAttachmentFile)
+		r.With(agent).Post("/conversations/{id}/takeover", TakeOverConversation)
+		r.With(agent).Post("/conversations/{id}/activate-bot", ActivateBot)
+		r.With(agent).Put("/conversations/{id}/takeover-timeout", SetTakeoverTimeout)
+		r.With(agent).Post("/conversations/{id}/claim", ClaimConversation)
+		r.With(agent).Post("/conversations/{id}/release", ReleaseConversation)
+		r.With(agent).Post("/conversations/{id}/transfer", TransferConversation)
+		r.With(agent).Post("/conversations/{id}/send", SendMessage)
 		r.Get("/knowledge-base", GetKnowledgeBase)
-		r.Put("/knowledge-base", UpdateKnowledgeBase)
+		r.With(owner).Put("/knowledge-base", UpdateKnowledgeBase)
+		r.Get("/knowledge-base/documents", ListKnowledgeDocuments)
+		r.With(owner).Post("/knowledge-base/documents", CreateKnowledgeDocument)
+		r.Get("/knowledge-base/documents/{id}", GetKnowledgeDocument)
+		r.With(owner).Put("/knowledge-base/documents/{id}", UpdateKnowledgeDocument)
+		r.With(owner).Delete("/knowledge-base/documents/{id}", DeleteKnowledgeDocument)
+		r.Get("/knowledge-base/revisions", ListKnowledgeRevisions)
+		r.Get("/knowledge-base/revisions/diff", DiffKnowledgeRevisions)
+		r.Get("/knowledge-base/revisions/{id}", GetKnowledgeRevision)
+		r.With(owner).Post("/knowledge-base/revisions/{id}/restore", RestoreKnowledgeRevision)
+		r.Get("/products", ListProducts)
+		r.With(owner).Post("/products", CreateProduct)
+		r.Get("/products/{id}", GetProduct)
+		r.With(owner).Put("/products/{id}", UpdateProduct)
+		r.With(owner).Delete("/products/{id}", DeleteProduct)
+		r.Get("/products/{id}/quote", QuoteProduct)
+		r.Get("/orders", ListOrders)
+		r.Get("/orders/{id}", GetOrder)
+		r.With(agent).Put("/orders/{id}/status", UpdateOrderStatus)
+		r.Get("/quick-replies", ListQuickReplies)
+		r.With(owner).Post("/quick-replies", CreateQuickReply)
+		r.With(owner).Put("/quick-replies/{id}", UpdateQuickReply)
+		r.With(owner).Delete("/quick-replies/{id}", DeleteQuickReply)
+		r.Get("/me", GetCurrentUser)
+		r.With(owner).Get("/admin-users", ListAdminUsers)
+		r.With(owner).Post("/admin-users", CreateAdminUser)
+		r.Put("/admin-users/{id}/password", SetAdminPassword)
+		r.With(owner).Put("/admin-users/{id}/role", SetAdminRole)
+		r.With(owner).Put("/admin-users/{id}/telegram", SetAdminTelegramID)
+		r.With(owner).Delete("/admin-users/{id}", DeleteAdminUser)
+		r.With(owner).Get("/audit", ListAuditEntries)
 	})
 
 	// Protected static files (auth required)
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"telecust/database"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/sessions"
+)
+
+// Session store, keyed by SESSION_SECRET
+var store *sessions.CookieStore
+
+// exampleSessionSecret is the placeholder older copies of .env.example shipped with.
+// It is public, so anyone could forge sessions signed with it.
+const exampleSessionSecret = "change-me-to-a-long-random-string"
+
+// initSessionStore sets up the cookie store. Without SESSION_SECRET a random key is
+// used, which logs everyone out on restart and does not work across instances.
+func initSessionStore() {
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if string(secret) == exampleSessionSecret {
+		log.Fatal("SESSION_SECRET is still the example value from .env.example, set it to a random key, e.g. from `openssl rand -hex 32`")
+	}
+	if len(secret) == 0 {
+		log.Println("Warning: SESSION_SECRET is not set, using a random key. Sessions end when the server restarts.")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate session key: %v", err)
+		}
+	} else if len(secret) < 32 {
+		log.Println("Warning: SESSION_SECRET should be at least 32 characters")
+	}
+
+	store = sessions.NewCookieStore(secret)
+	store.Options.HttpOnly = true
+	store.Options.SameSite = http.SameSiteLaxMode
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// sessionUser returns the dashboard user of the request's session, or nil when the
+// session is missing or the user has been deleted
+func sessionUser(r *http.Request) *database.AdminUser {
+	session, _ := store.Get(r, "auth-session")
+	if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
+		return nil
+	}
+	id, ok := session.Values["user_id"].(int)
+	if !ok {
+		return nil
+	}
+
+	user, err := database.GetAdminUser(id)
+	if err != nil {
+		log.Printf("Error loading session user %d: %v", id, err)
+		return nil
+	}
+	return user
+}
+
+// withUser stores the authenticated user in the request context
+func withUser(r *http.Request, user *database.AdminUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// currentUser returns the authenticated user set by the auth middleware
+func currentUser(r *http.Request) *database.AdminUser {
+	user, _ := r.Context().Value(userContextKey).(*database.AdminUser)
+	return user
+}
+
+// requireRole rejects requests from users below the given role with 403 Forbidden.
+// It runs after the auth middleware, which sets the user.
+func requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := currentUser(r)
+			if user == nil || !user.HasRole(role) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden: requires the " + role + " role"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetCurrentUser returns the logged in dashboard user
+func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentUser(r))
+}
+
+// ListAdminUsers returns all dashboard users
+func ListAdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := database.ListAdminUsers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if users == nil {
+		users = []database.AdminUser{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// CreateAdminUser adds a dashboard user
+func CreateAdminUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = database.RoleAgent
+	}
+
+	user := &database.AdminUser{Username: req.Username, Role: req.Role}
+	err = database.CreateAdminUser(user, req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	audit(r, "user.create", "user", user.ID, user)
+	log.Printf("Dashboard user %q created by %q", user.Username, currentUsername(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetAdminPassword changes a dashboard user's password. Everyone may change their
+// own password, only owners may change other users'.
+func SetAdminPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if me := currentUser(r); me.ID != user.ID && !me.HasRole(database.RoleOwner) {
+		http.Error(w, "Only owners can change other users' passwords", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.ValidatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.SetAdminPassword(user.ID, req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The password itself is never logged
+	audit(r, "user.password", "user", user.ID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// SetAdminRole changes a dashboard user's role
+func SetAdminRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !database.ValidRole(req.Role) {
+		http.Error(w, "Invalid role, use owner, agent or viewer", http.StatusBadRequest)
+		return
+	}
+
+	if user.Role == database.RoleOwner && req.Role != database.RoleOwner && !keepsAnOwner(w) {
+		return
+	}
+
+	auditBefore(r, map[string]string{"role": user.Role})
+
+	err = database.SetAdminRole(user.ID, req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "user.role", "user", user.ID, map[string]string{"role": req.Role})
+
+	log.Printf("Dashboard user %q is now %s (changed by %q)", user.Username, req.Role, currentUsername(r))
+
+	user.Role = req.Role
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetAdminTelegramID links a dashboard user to the Telegram account they use in the
+// staff group and forum, 0 unlinks it. Only linked agents may act on conversations there.
+func SetAdminTelegramID(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TelegramID int64 `json:"telegram_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	auditBefore(r, map[string]int64{"telegram_id": user.TelegramID})
+
+	err = database.SetAdminTelegramID(user.ID, req.TelegramID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	audit(r, "user.telegram", "user", user.ID, map[string]int64{"telegram_id": req.TelegramID})
+
+	user.TelegramID = req.TelegramID
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// keepsAnOwner checks that an owner is left after one loses the role, writing an error response if not
+func keepsAnOwner(w http.ResponseWriter) bool {
+	owners, err := database.CountOwners()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if owners <= 1 {
+		http.Error(w, "There must be at least one owner", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// DeleteAdminUser removes a dashboard user. Users cannot delete themselves and the
+// last owner cannot be removed, so someone can always manage the dashboard.
+func DeleteAdminUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if me := currentUser(r); me != nil && me.ID == user.ID {
+		http.Error(w, "You cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+	if user.Role == database.RoleOwner && !keepsAnOwner(w) {
+		return
+	}
+
+	auditBefore(r, user)
+
+	err := database.DeleteAdminUser(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Their conversations go back to the unassigned queue
+	if err := database.ReleaseAgentConversations(user.Username); err != nil {
+		log.Printf("Error releasing conversations of %q: %v", user.Username, err)
+	}
+
+	audit(r, "user.delete", "user", user.ID, nil)
+
+	log.Printf("Dashboard user %q deleted by %q", user.Username, currentUsername(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// loadAdminUser reads the {id} URL parameter and loads the user, writing an error response on failure
+func loadAdminUser(w http.ResponseWriter, r *http.Request) (*database.AdminUser, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := database.GetAdminUser(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
@@ -1,38 +1,73 @@
 package bot
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"telecust/database"
+	"time"
 )
 
-type OpenAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Set on assistant messages that call tools
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Set on "tool" messages carrying a result
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// requestTimeout bounds a single call to the AI provider
+const requestTimeout = 60 * time.Second
+
+// PromptVersion identifies the system prompt template. Bump it whenever the prompt
+// changes so stored replies can be traced back to the instructions the model saw.
+const PromptVersion = "kb-v8"
+
+// greetingPromptVersion marks replies produced by the greeting shortcut without calling the AI
+const greetingPromptVersion = "greeting"
+
+// Reply is the bot's answer together with the details of how it was produced
+type Reply struct {
+	Text     string
+	Audit    *database.MessageAudit
+	Order    *database.Order // Set when the reply created an order the customer must confirm
+	Greeting bool            // Set when the greeting shortcut answered without calling the AI
+	Failed   bool            // Set when the AI could not be reached and Text is a fallback
+
+	// Handoff is the reason a human should take over, set when the model replies with
+	// the handoff marker or calls the request_handoff tool, or when the AI keeps failing
+	Handoff        string
+	HandoffTrigger string
 }
 
-type OpenAIResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
+// QueryKnowledgeBase uses the configured AI provider to answer user queries based on knowledge base and conversation history
+func QueryKnowledgeBase(userQuery, knowledgeBase string, conversationID int) *Reply {
+	return QueryKnowledgeBaseStream(userQuery, knowledgeBase, conversationID, nil)
 }
 
-// QueryKnowledgeBase uses OpenAI to answer user queries based on knowledge base and conversation history
-func QueryKnowledgeBase(userQuery, knowledgeBase string, conversationID int) string {
+// QueryKnowledgeBaseStream works like QueryKnowledgeBase but, when onUpdate is set and the
+// provider supports streaming, calls it with the accumulated reply text as it is generated.
+// The returned reply always holds the complete final text.
+func QueryKnowledgeBaseStream(userQuery, knowledgeBase string, conversationID int, onUpdate func(text string)) *Reply {
 	log.Printf("[AI] Received query: %s (conversation ID: %d)", userQuery, conversationID)
 
+	start := time.Now()
+	audit := &database.MessageAudit{PromptVersion: PromptVersion}
+	if revisionID, err := database.GetLatestKnowledgeRevisionID(); err == nil {
+		audit.KBRevisionID = revisionID
+	} else {
+		log.Printf("[AI] Warning: Could not load knowledge base revision: %v", err)
+	}
+
+	result := &Reply{Audit: audit}
+	reply := func(text string) *Reply {
+		audit.LatencyMs = time.Since(start).Milliseconds()
+		result.Text = text
+		return result
+	}
+
 	// Check for simple greetings first
 	greetings := []string{"halo", "hai", "hi", "hello", "hey", "selamat"}
 	queryLower := strings.ToLower(userQuery)
@@ -40,24 +75,21 @@ func QueryKnowledgeBase(userQuery, knowledgeBase string, conversationID int) str
 	for _, greeting := range greetings {
 		if strings.Contains(queryLower, greeting) && len(userQuery) < 20 {
 			log.Printf("[AI] Detected greeting, returning instant response")
-			return "Apa yang bisa saya bantu, kak?"
+			audit.PromptVersion = greetingPromptVersion
+			result.Greeting = true
+			return reply("Apa yang bisa saya bantu, kak?")
 		}
 	}
 
-	// Use OpenAI for other queries
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	apiBase := os.Getenv("OPENAI_API_BASE")
-
-	if apiKey == "" {
-		log.Printf("[AI] ERROR: OPENAI_API_KEY not configured")
-		return "Maaf, sistem AI belum dikonfigurasi. Silakan hubungi admin."
+	// Use the configured AI provider for other queries
+	provider := CurrentProvider()
+	if provider == nil {
+		log.Printf("[AI] ERROR: AI provider not configured")
+		result.Failed = true
+		return reply("Maaf, sistem AI belum dikonfigurasi. Silakan hubungi admin.")
 	}
 
-	if apiBase == "" {
-		apiBase = "https://api.openai.com/v1"
-	}
-
-	log.Printf("[AI] Using OpenAI API: %s", apiBase)
+	log.Printf("[AI] Using provider: %s", provider.Name())
 
 	// Build the system prompt with knowledge base
 	systemPrompt := fmt.Sprintf(`Kamu adalah asisten customer service yang ramah dan membantu.
@@ -69,9 +101,20 @@ Instruksi:
 - Jawab dengan bahasa Indonesia yang sopan dan ramah
 - Gunakan sapaan "kak" untuk customer
 - PENTING: Perhatikan riwayat percakapan dengan baik. Jika customer bertanya tentang pesanan mereka sebelumnya, lihat di riwayat chat apa yang mereka pesan
-- Jika pertanyaan tidak bisa dijawab dari knowledge base, beritahu dengan sopan bahwa kamu tidak memiliki informasi tersebut
+- %s
 - Jawab singkat dan jelas
-- Jangan mengarang informasi yang tidak ada di knowledge base atau riwayat percakapan`, knowledgeBase)
+- Jangan mengarang informasi yang tidak ada di knowledge base atau riwayat percakapan
+- Jika tersedia, gunakan tools untuk menghitung total harga dan mengecek jam operasional, jangan menghitung sendiri
+- Jika customer ingin memesan dan produk serta jumlahnya sudah jelas, catat dengan tool create_order. Customer akan mengkonfirmasi lewat tombol, jadi jangan bilang pesanan sudah diproses
+- Pesan yang diawali [Foto], [Dokumen], [Video] dan sejenisnya berarti customer mengirim file. Kamu tidak bisa melihat isinya, jadi jawab teks yang menyertainya dan sampaikan bahwa admin akan mengecek filenya`, knowledgeBase, handoffInstruction())
+
+	// Quantities next to a product name or unit are priced from the catalog so totals add up
+	if hints := priceHints(userQuery); hints != "" {
+		systemPrompt += fmt.Sprintf(`
+
+Harga dari katalog untuk jumlah yang tampaknya disebut customer. Pakai hanya jika jumlah dan produknya memang yang dimaksud customer; jika ragu, tanyakan atau hitung dengan tool calculate_price:
+%s`, hints)
+	}
 
 	log.Printf("[AI] Knowledge base length: %d characters", len(knowledgeBase))
 
@@ -92,22 +135,19 @@ Instruksi:
 	}
 	log.Printf("[AI] Loaded %d messages from database", len(history))
 
-	// Convert history to OpenAI message format, excluding the current message
-	// Check if the last message is the current one (which we just saved)
-	skipLastMessage := false
-	if len(history) > 0 {
-		lastMsg := history[len(history)-1]
-		if lastMsg.MessageText == userQuery && lastMsg.SenderType == "user" {
-			skipLastMessage = true
-			log.Printf("[AI] Detected current message in history, will exclude it")
-		}
+	// Convert history to chat message format, excluding the current message
+	// Check if the last messages are the current one (which we just saved). Several
+	// messages answered together arrive as one query, joined by newlines.
+	skipLastMessages := currentMessageCount(history, userQuery)
+	if skipLastMessages > 0 {
+		log.Printf("[AI] Detected current message in history (%d messages), will exclude it", skipLastMessages)
 	}
 
 	var conversationHistory []Message
 	for i, msg := range history {
-		// Skip the last message if it's the current one
-		if skipLastMessage && i == len(history)-1 {
-			log.Printf("[AI] Skipping current message from history (last position)")
+		// Skip the last messages if they are the current one
+		if i >= len(history)-skipLastMessages {
+			log.Printf("[AI] Skipping current message from history (position %d)", i)
 			continue
 		}
 
@@ -119,122 +159,76 @@ Instruksi:
 			role = "assistant"
 		}
 
+		content := historyContent(msg)
 		conversationHistory = append(conversationHistory, Message{
 			Role:    role,
-			Content: msg.MessageText,
+			Content: content,
 		})
 
-		log.Printf("[AI] History[%d]: %s said: %s", i, role, msg.MessageText)
+		log.Printf("[AI] History[%d]: %s said: %s", i, role, content)
 	}
 
 	log.Printf("[AI] Current user query: %s", userQuery)
-	log.Printf("[AI] Calling OpenAI API with %d history messages...", len(conversationHistory))
-
-	// Call OpenAI API with conversation history
-	response, err := callOpenAI(apiBase, apiKey, systemPrompt, userQuery, conversationHistory)
-	if err != nil {
-		log.Printf("[AI] ERROR: OpenAI API failed: %v", err)
-		// Fallback to simple response
-		return "Maaf, saya sedang mengalami kendala. Bisa ulangi pertanyaannya?"
-	}
-
-	log.Printf("[AI] SUCCESS: Received response from OpenAI (length: %d chars)", len(response))
-	log.Printf("[AI] Response: %s", response)
-
-	return response
-}
-
-func callOpenAI(apiBase, apiKey, systemPrompt, userMessage string, conversationHistory []Message) (string, error) {
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimSuffix(apiBase, "/"))
-	log.Printf("[OpenAI] POST %s", url)
-
-	// Get model from env, default to gpt-3.5-turbo
-	model := os.Getenv("OPENAI_MODEL")
-	if model == "" {
-		model = "gpt-3.5-turbo"
-	}
-	log.Printf("[OpenAI] Using model: %s", model)
+	log.Printf("[AI] Calling %s with %d history messages...", provider.Name(), len(conversationHistory))
 
 	// Build messages array: system prompt + conversation history + current user message
-	messages := []Message{
-		{
-			Role:    "system",
-			Content: systemPrompt,
-		},
-	}
-
-	// Add conversation history
+	messages := []Message{{Role: "system", Content: systemPrompt}}
 	messages = append(messages, conversationHistory...)
+	messages = append(messages, Message{Role: "user", Content: userQuery})
 
-	// Add current user message
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: userMessage,
-	})
-
-	log.Printf("[OpenAI] Total messages in request: %d (1 system + %d history + 1 current)", len(messages), len(conversationHistory))
-
-	requestBody := OpenAIRequest{
-		Model:    model,
-		Messages: messages,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		log.Printf("[OpenAI] Failed to marshal request: %v", err)
-		return "", err
-	}
-
-	log.Printf("[OpenAI] Request body size: %d bytes", len(jsonData))
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("[OpenAI] Failed to create request: %v", err)
-		return "", err
+	// The handoff marker is never shown while the reply streams in
+	if onUpdate != nil {
+		show := onUpdate
+		onUpdate = func(text string) { show(hideHandoffMarker(text)) }
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-	log.Printf("[OpenAI] Using API key: %s", maskKey(apiKey))
-
-	client := &http.Client{}
-	log.Printf("[OpenAI] Sending request...")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("[OpenAI] HTTP request failed: %v", err)
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	log.Printf("[OpenAI] Response status: %d %s", resp.StatusCode, resp.Status)
-
-	body, err := io.ReadAll(resp.Body)
+	// Tools the model calls are run here and their results fed back until it answers
+	completion, err := runCompletion(ctx, provider, messages, ToolContext{ConversationID: conversationID, Reply: result}, onUpdate)
 	if err != nil {
-		log.Printf("[OpenAI] Failed to read response body: %v", err)
-		return "", err
+		log.Printf("[AI] ERROR: %s request failed: %v", provider.Name(), err)
+		// Fallback to simple response
+		result.Failed = true
+		return reply("Maaf, saya sedang mengalami kendala. Bisa ulangi pertanyaannya?")
 	}
 
-	log.Printf("[OpenAI] Response body size: %d bytes", len(body))
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[OpenAI] API returned error: %s", string(body))
-		return "", fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(body))
-	}
+	response := completion.Content
+	log.Printf("[AI] SUCCESS: Received response from %s model %s (length: %d chars, tokens: %d)",
+		provider.Name(), completion.Model, len(response), completion.Usage.TotalTokens)
+	log.Printf("[AI] Response: %s", response)
 
-	var openAIResp OpenAIResponse
-	err = json.Unmarshal(body, &openAIResp)
-	if err != nil {
-		log.Printf("[OpenAI] Failed to parse response JSON: %v", err)
-		return "", err
+	audit.Model = completion.Model
+	audit.PromptTokens = completion.Usage.PromptTokens
+	audit.CompletionTokens = completion.Usage.CompletionTokens
+	audit.TotalTokens = completion.Usage.TotalTokens
+
+	// A model that cannot answer confidently replies with the handoff marker
+	if text, reason, found := parseHandoffMarker(response); found {
+		log.Printf("[AI] Model handed off: %s", reason)
+		response = text
+		if handoff.enabled && result.Handoff == "" {
+			result.Handoff = reason
+		}
+		if response == "" && result.Handoff == "" {
+			response = "Maaf kak, untuk pertanyaan itu kami belum memiliki informasinya."
+		}
 	}
+	return reply(response)
+}
 
-	if len(openAIResp.Choices) == 0 {
-		log.Printf("[OpenAI] No choices in response")
-		return "", fmt.Errorf("no response from OpenAI")
+// currentMessageCount returns how many trailing user messages in history make up the
+// current query, or 0 when the query is not in history
+func currentMessageCount(history []database.Message, userQuery string) int {
+	var texts []string
+	for i := len(history) - 1; i >= 0 && history[i].SenderType == "user"; i-- {
+		texts = append([]string{historyContent(history[i])}, texts...)
+		if strings.Join(texts, "\n") == userQuery {
+			return len(texts)
+		}
 	}
-
-	log.Printf("[OpenAI] Successfully parsed response, choices: %d", len(openAIResp.Choices))
-	return openAIResp.Choices[0].Message.Content, nil
+	return 0
 }
 
 // maskKey masks the API key for logging (shows only first and last 4 chars)
@@ -244,3 +238,13 @@ func maskKey(key string) string {
 	}
 	return key[:4] + "****" + key[len(key)-4:]
 }
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
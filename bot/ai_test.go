@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"telecust/database"
+	"testing"
+)
+
+func TestQueryKnowledgeBaseStream(t *testing.T) {
+	const query = "Berapa harga keripik untuk pesanan besar?"
+
+	tests := []struct {
+		name       string
+		provider   func() Provider // nil means no provider configured
+		stream     bool            // Pass an onUpdate callback
+		query      string
+		wantText   string
+		wantFailed bool
+		wantCalls  int
+		wantModel  string
+		wantTokens int
+		wantUpdate []string
+	}{
+		{
+			name:       "no provider",
+			query:      query,
+			wantText:   "Maaf, sistem AI belum dikonfigurasi. Silakan hubungi admin.",
+			wantFailed: true,
+		},
+		{
+			name:     "greeting skips the provider",
+			provider: func() Provider { return &fakeProvider{} },
+			query:    "halo",
+			wantText: "Apa yang bisa saya bantu, kak?",
+		},
+		{
+			name: "completion",
+			provider: func() Provider {
+				return &fakeProvider{responses: []fakeResponse{{completion: Completion{
+					Content: "Harganya Rp4ribu per bungkus, kak",
+					Model:   "fake-large",
+					Usage:   Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+				}}}}
+			},
+			query:      query,
+			wantText:   "Harganya Rp4ribu per bungkus, kak",
+			wantCalls:  1,
+			wantModel:  "fake-large",
+			wantTokens: 120,
+		},
+		{
+			name: "provider error falls back",
+			provider: func() Provider {
+				return &fakeProvider{responses: []fakeResponse{{err: errors.New("boom")}}}
+			},
+			query:      query,
+			wantText:   "Maaf, saya sedang mengalami kendala. Bisa ulangi pertanyaannya?",
+			wantFailed: true,
+			wantCalls:  1,
+		},
+		{
+			name: "streaming provider reports partial text",
+			provider: func() Provider {
+				return &fakeStreamingProvider{chunkSize: 4, fakeProvider: fakeProvider{
+					responses: []fakeResponse{{completion: Completion{Content: "Ada kak!"}}},
+				}}
+			},
+			stream:     true,
+			query:      query,
+			wantText:   "Ada kak!",
+			wantCalls:  1,
+			wantModel:  "fake-model",
+			wantUpdate: []string{"Ada ", "Ada kak!"},
+		},
+		{
+			name: "streaming provider without callback completes normally",
+			provider: func() Provider {
+				return &fakeStreamingProvider{chunkSize: 4, fakeProvider: fakeProvider{
+					responses: []fakeResponse{{completion: Completion{Content: "Ada kak!"}}},
+				}}
+			},
+			query:     query,
+			wantText:  "Ada kak!",
+			wantCalls: 1,
+			wantModel: "fake-model",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			conv := newTestConversation(t, int64(1000+i))
+
+			var provider Provider
+			if tt.provider != nil {
+				provider = tt.provider()
+			}
+			useFakeProvider(t, provider)
+
+			var updates []string
+			var onUpdate func(string)
+			if tt.stream {
+				onUpdate = func(text string) { updates = append(updates, text) }
+			}
+
+			reply := QueryKnowledgeBaseStream(tt.query, "Harga kentang Rp5ribu", conv.ID, onUpdate)
+
+			if reply.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", reply.Text, tt.wantText)
+			}
+			if reply.Failed != tt.wantFailed {
+				t.Errorf("Failed = %v, want %v", reply.Failed, tt.wantFailed)
+			}
+			if reply.Audit.Model != tt.wantModel {
+				t.Errorf("Audit.Model = %q, want %q", reply.Audit.Model, tt.wantModel)
+			}
+			if reply.Audit.TotalTokens != tt.wantTokens {
+				t.Errorf("Audit.TotalTokens = %d, want %d", reply.Audit.TotalTokens, tt.wantTokens)
+			}
+			if strings.Join(updates, "|") != strings.Join(tt.wantUpdate, "|") {
+				t.Errorf("updates = %q, want %q", updates, tt.wantUpdate)
+			}
+
+			calls := 0
+			switch p := provider.(type) {
+			case *fakeProvider:
+				calls = len(p.requests)
+			case *fakeStreamingProvider:
+				calls = len(p.requests)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestQueryKnowledgeBasePrompt(t *testing.T) {
+	useTestDB(t)
+	conv := newTestConversation(t, 2000)
+	provider := &fakeProvider{}
+	useFakeProvider(t, provider)
+
+	// The current message is already saved, as the handler does before querying
+	for _, m := range []struct{ sender, text string }{
+		{"user", "Apakah ada keripik pedas?"},
+		{"bot", "Ada kak, harganya sama"},
+		{"admin", "Stok tinggal sedikit ya kak"},
+		{"user", "Saya mau pesan dua puluh bungkus"},
+	} {
+		if err := database.SaveMessage(conv.ID, m.sender, m.text); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+	}
+
+	QueryKnowledgeBase("Saya mau pesan dua puluh bungkus", "Harga kentang Rp5ribu", conv.ID)
+
+	if len(provider.requests) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(provider.requests))
+	}
+	messages := provider.requests[0].messages
+
+	if messages[0].Role != "system" || !strings.Contains(messages[0].Content, "Harga kentang Rp5ribu") {
+		t.Errorf("first message is not the system prompt with the knowledge base: %+v", messages[0])
+	}
+
+	var got []string
+	for _, m := range messages[1:] {
+		got = append(got, m.Role+": "+m.Content)
+	}
+	want := []string{
+		"user: Apakah ada keripik pedas?",
+		"assistant: Ada kak, harganya sama",
+		"assistant: Stok tinggal sedikit ya kak",
+		"user: Saya mau pesan dua puluh bungkus",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages after the system prompt:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// useHandoffPolicy makes a policy read from the environment active for the rest of the test
+func useHandoffPolicy(t *testing.T, enabled bool) {
+	t.Helper()
+
+	previous := handoff
+	handoff = newHandoffPolicy()
+	handoff.enabled = enabled
+	t.Cleanup(func() { handoff = previous })
+}
+
+func TestQueryKnowledgeBaseHandoffMarker(t *testing.T) {
+	const query = "Apakah produknya bergaransi?"
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		content     string
+		wantText    string
+		wantHandoff string
+	}{
+		{"marker with reason", true, "[HANDOFF] Garansi tidak ada di knowledge base", "", "Garansi tidak ada di knowledge base"},
+		{"marker without reason", true, "[HANDOFF]", "", defaultHandoffReason},
+		{"text before the marker", true, "Sebentar kak.\n[HANDOFF] Garansi", "Sebentar kak.", "Garansi"},
+		{"no marker", true, "Bergaransi 1 tahun kak", "Bergaransi 1 tahun kak", ""},
+		{"handoff disabled", false, "[HANDOFF] Garansi", "Maaf kak, untuk pertanyaan itu kami belum memiliki informasinya.", ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			useHandoffPolicy(t, tt.enabled)
+			conv := newTestConversation(t, int64(3000+i))
+			provider := &fakeStreamingProvider{chunkSize: 3, fakeProvider: fakeProvider{
+				responses: []fakeResponse{{completion: Completion{Content: tt.content}}},
+			}}
+			useFakeProvider(t, provider)
+
+			var updates []string
+			reply := QueryKnowledgeBaseStream(query, "Harga kentang Rp5ribu", conv.ID, func(text string) { updates = append(updates, text) })
+
+			if reply.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", reply.Text, tt.wantText)
+			}
+			if reply.Handoff != tt.wantHandoff {
+				t.Errorf("Handoff = %q, want %q", reply.Handoff, tt.wantHandoff)
+			}
+			for _, update := range updates {
+				if strings.Contains(update, "[") {
+					t.Errorf("partial reply %q shows the handoff marker", update)
+				}
+			}
+		})
+	}
+}
+
+func TestHideHandoffMarker(t *testing.T) {
+	tests := map[string]string{
+		"Ada kak":              "Ada kak",
+		"Sebentar [HAN":        "Sebentar ",
+		"[":                    "",
+		"Sebentar [HANDOFF] x": "Sebentar ",
+	}
+	for text, want := range tests {
+		if got := hideHandoffMarker(text); got != want {
+			t.Errorf("hideHandoffMarker(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
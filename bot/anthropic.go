@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+type anthropicRequest struct {
+	Model     string    `json:"model"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// AnthropicProvider talks to the Anthropic Messages API
+type AnthropicProvider struct {
+	APIBase string
+	APIKey  string
+	Model   string
+}
+
+// NewAnthropicProvider creates an Anthropic provider, filling in defaults for base URL and model
+func NewAnthropicProvider(apiBase, apiKey, model string) (*AnthropicProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set")
+	}
+	if apiBase == "" {
+		apiBase = "https://api.anthropic.com/v1"
+	}
+	if model == "" {
+		model = "claude-3-5-haiku-latest"
+	}
+
+	return &AnthropicProvider{
+		APIBase: strings.TrimSuffix(apiBase, "/"),
+		APIKey:  apiKey,
+		Model:   model,
+	}, nil
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (*Completion, error) {
+	model := p.Model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	maxTokens := opts.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 1024
+	}
+	log.Printf("[Anthropic] Using model: %s, API key: %s", model, maskKey(p.APIKey))
+
+	// The system prompt is a top-level field instead of a message
+	requestBody := anthropicRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+	}
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			requestBody.System = msg.Content
+			continue
+		}
+		requestBody.Messages = append(requestBody.Messages, msg)
+	}
+
+	var anthropicResp anthropicResponse
+	err := postJSON(ctx, "Anthropic", p.APIBase+"/messages", map[string]string{
+		"x-api-key":         p.APIKey,
+		"anthropic-version": "2023-06-01",
+	}, requestBody, &anthropicResp)
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range anthropicResp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	if text.Len() == 0 {
+		log.Printf("[Anthropic] No text content in response")
+		return nil, fmt.Errorf("no response from Anthropic")
+	}
+
+	return &Completion{
+		Content: text.String(),
+		Model:   firstNonEmpty(anthropicResp.Model, model),
+		Usage: Usage{
+			PromptTokens:     anthropicResp.Usage.InputTokens,
+			CompletionTokens: anthropicResp.Usage.OutputTokens,
+			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"telecust/database"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// downloadTimeout bounds a single file download from Telegram
+const downloadTimeout = 2 * time.Minute
+
+// attachmentFromMessage returns the file carried by a Telegram message, or nil for plain text
+func attachmentFromMessage(message *tgbotapi.Message) *database.Attachment {
+	att := &database.Attachment{Caption: message.Caption}
+
+	switch {
+	case len(message.Photo) > 0:
+		// Telegram sends several sizes, the last one is the largest
+		photo := message.Photo[len(message.Photo)-1]
+		att.Kind = database.AttachmentPhoto
+		att.FileID = photo.FileID
+		att.FileUniqueID = photo.FileUniqueID
+		att.FileSize = int64(photo.FileSize)
+		att.Width = photo.Width
+		att.Height = photo.Height
+	case message.Document != nil:
+		att.Kind = database.AttachmentDocument
+		att.FileID = message.Document.FileID
+		att.FileUniqueID = message.Document.FileUniqueID
+		att.FileName = message.Document.FileName
+		att.MimeType = message.Document.MimeType
+		att.FileSize = int64(message.Document.FileSize)
+	case message.Voice != nil:
+		att.Kind = database.AttachmentVoice
+		att.FileID = message.Voice.FileID
+		att.FileUniqueID = message.Voice.FileUniqueID
+		att.MimeType = message.Voice.MimeType
+		att.FileSize = int64(message.Voice.FileSize)
+		att.Duration = message.Voice.Duration
+	case message.Audio != nil:
+		att.Kind = database.AttachmentAudio
+		att.FileID = message.Audio.FileID
+		att.FileUniqueID = message.Audio.FileUniqueID
+		att.FileName = message.Audio.FileName
+		att.MimeType = message.Audio.MimeType
+		att.FileSize = int64(message.Audio.FileSize)
+		att.Duration = message.Audio.Duration
+	case message.Video != nil:
+		att.Kind = database.AttachmentVideo
+		att.FileID = message.Video.FileID
+		att.FileUniqueID = message.Video.FileUniqueID
+		att.FileName = message.Video.FileName
+		att.MimeType = message.Video.MimeType
+		att.FileSize = int64(message.Video.FileSize)
+		att.Width = message.Video.Width
+		att.Height = message.Video.Height
+		att.Duration = message.Video.Duration
+	case message.Sticker != nil:
+		att.Kind = database.AttachmentSticker
+		att.FileID = message.Sticker.FileID
+		att.FileUniqueID = message.Sticker.FileUniqueID
+		att.FileSize = int64(message.Sticker.FileSize)
+		att.Width = message.Sticker.Width
+		att.Height = message.Sticker.Height
+		att.Emoji = message.Sticker.Emoji
+		if message.Sticker.IsAnimated {
+			att.MimeType = "application/x-tgsticker"
+		} else {
+			att.MimeType = "image/webp"
+		}
+	default:
+		return nil
+	}
+
+	return att
+}
+
+// attachmentLabel names an attachment kind for customers and the AI
+func attachmentLabel(kind string) string {
+	switch kind {
+	case database.AttachmentPhoto:
+		return "Foto"
+	case database.AttachmentDocument:
+		return "Dokumen"
+	case database.AttachmentVoice:
+		return "Pesan suara"
+	case database.AttachmentAudio:
+		return "Audio"
+	case database.AttachmentVideo:
+		return "Video"
+	case database.AttachmentSticker:
+		return "Stiker"
+	}
+	return "File"
+}
+
+// historyContent is how a stored message is shown to the AI: attachments become a
+// "[Foto]"-style marker in front of the caption, and transcribed voice messages are
+// shown as the text that was spoken
+func historyContent(msg database.Message) string {
+	text := msg.MessageText
+	for _, att := range msg.Attachments {
+		if att.Transcript != "" {
+			if text == "" {
+				text = att.Transcript
+			} else {
+				text = att.Transcript + "\n" + text
+			}
+			continue
+		}
+
+		marker := "[" + attachmentLabel(att.Kind) + "]"
+		if att.Emoji != "" {
+			marker = "[" + attachmentLabel(att.Kind) + " " + att.Emoji + "]"
+		}
+		if text == "" {
+			text = marker
+		} else {
+			text = marker + " " + text
+		}
+	}
+	return text
+}
+
+// respondToAttachment answers a customer message that carries a file. Voice messages
+// are transcribed and answered like text, with a caption the AI answers the caption,
+// otherwise the customer gets a short acknowledgement.
+func (b *Bot) respondToAttachment(chatID int64, conv *database.Conversation, msg database.Message) {
+	att := &msg.Attachments[0]
+
+	// Transcribe even while an admin has taken over, so the transcript shows in the dashboard
+	err := b.transcribeAttachment(att)
+	if err != nil {
+		log.Printf("[STT] Error transcribing attachment %d: %v", att.ID, err)
+	}
+
+	if msg.MessageText != "" || att.Transcript != "" {
+		b.queueResponse(chatID, conv, historyContent(msg))
+		return
+	}
+
+	if !conv.IsBotActive {
+		log.Printf("[BOT] Bot inactive for chat %d, admin mode - not responding", chatID)
+		return
+	}
+
+	var text string
+	switch att.Kind {
+	case database.AttachmentSticker:
+		// Nothing to answer
+		return
+	case database.AttachmentVoice, database.AttachmentAudio:
+		text = "Maaf kak, pesan suara belum bisa kami dengarkan. Mohon ketik pertanyaannya ya."
+	default:
+		text = fmt.Sprintf("Terima kasih kak, %s sudah kami terima. Admin kami akan segera mengeceknya.",
+			attachmentLabel(att.Kind))
+	}
+
+	b.sendMessage(chatID, text)
+	err = database.SaveMessage(conv.ID, "bot", text)
+	if err != nil {
+		log.Printf("[BOT] Error saving bot response: %v", err)
+	}
+}
+
+// attachmentsDir is where downloaded files are kept, configured with ATTACHMENTS_DIR
+func attachmentsDir() string {
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return dir
+	}
+	return "attachments"
+}
+
+// DownloadAttachment fetches an attachment from Telegram into local storage and
+// returns its path. Telegram only serves files up to 20 MB to bots.
+func (b *Bot) DownloadAttachment(att *database.Attachment) (string, error) {
+	file, err := b.API.GetFile(tgbotapi.FileConfig{FileID: att.FileID})
+	if err != nil {
+		return "", fmt.Errorf("get file: %w", err)
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(file.Link(b.API.Token))
+	if err != nil {
+		return "", fmt.Errorf("download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download file: status %d", resp.StatusCode)
+	}
+
+	dir := filepath.Join(attachmentsDir(), strconv.Itoa(att.ConversationID))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(dir, strconv.Itoa(att.ID)+path.Ext(file.FilePath))
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("save file: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), localPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = database.SetAttachmentLocalPath(att.ID, localPath)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("[BOT] Downloaded %s attachment %d to %s", att.Kind, att.ID, localPath)
+	att.LocalPath = localPath
+	att.Downloaded = true
+	return localPath, nil
+}
+
+// SendFileAsAdmin sends a photo or document from a dashboard user to a customer with
+// an optional caption, stores it as an admin message and keeps a local copy of the file
+func (b *Bot) SendFileAsAdmin(chatID int64, conversationID int, sentBy, kind, fileName string, data []byte, caption string) (*database.Attachment, error) {
+	file := tgbotapi.FileBytes{Name: fileName, Bytes: data}
+
+	var config tgbotapi.Chattable
+	switch kind {
+	case database.AttachmentPhoto:
+		photo := tgbotapi.NewPhoto(chatID, file)
+		photo.Caption = caption
+		config = photo
+	case database.AttachmentDocument:
+		document := tgbotapi.NewDocument(chatID, file)
+		document.Caption = caption
+		config = document
+	default:
+		return nil, fmt.Errorf("cannot send %q attachments", kind)
+	}
+
+	sent, err := b.API.Send(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use what Telegram stored, so the file_id can be reused and sizes are accurate
+	att := attachmentFromMessage(&sent)
+	if att == nil {
+		return nil, fmt.Errorf("telegram did not return the sent file")
+	}
+	if att.FileName == "" {
+		att.FileName = fileName
+	}
+
+	err = database.SaveMessageWithAttachment(conversationID, "admin", sentBy, caption, att)
+	if err != nil {
+		return nil, err
+	}
+
+	// The upload is already in hand, so store it instead of downloading it again later
+	dir := filepath.Join(attachmentsDir(), strconv.Itoa(conversationID))
+	localPath := filepath.Join(dir, strconv.Itoa(att.ID)+filepath.Ext(fileName))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[BOT] Error creating attachment directory: %v", err)
+	} else if err := os.WriteFile(localPath, data, 0644); err != nil {
+		log.Printf("[BOT] Error saving sent attachment: %v", err)
+	} else if err := database.SetAttachmentLocalPath(att.ID, localPath); err != nil {
+		log.Printf("[BOT] Error saving attachment path: %v", err)
+	} else {
+		att.LocalPath = localPath
+		att.Downloaded = true
+	}
+
+	log.Printf("[BOT] Admin sent %s %q to chat %d", att.Kind, fileName, chatID)
+	return att, nil
+}
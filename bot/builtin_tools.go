@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"telecust/database"
+	"time"
+	_ "time/tzdata" // Business hours need time zones even in minimal containers
+)
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "check_business_hours",
+		Description: "Cek apakah toko sedang buka sekarang dan jam operasionalnya.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		Handler: checkBusinessHours,
+	})
+
+	RegisterTool(Tool{
+		Name:        "calculate_total",
+		Description: "Hitung total harga dari daftar item (jumlah x harga satuan). Selalu gunakan ini untuk menjumlahkan harga, jangan menghitung sendiri.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"name":       map[string]interface{}{"type": "string"},
+							"quantity":   map[string]interface{}{"type": "integer"},
+							"unit_price": map[string]interface{}{"type": "integer", "description": "Harga satuan dalam Rupiah"},
+						},
+						"required": []string{"quantity", "unit_price"},
+					},
+				},
+			},
+			"required": []string{"items"},
+		},
+		Handler: calculateTotal,
+	})
+}
+
+// checkBusinessHours reports whether the shop is open, configured with
+// BUSINESS_HOURS (default 08:00-17:00), BUSINESS_DAYS (default mon-sat)
+// and BUSINESS_TIMEZONE (default Asia/Jakarta)
+func checkBusinessHours(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	hours := os.Getenv("BUSINESS_HOURS")
+	if hours == "" {
+		hours = "08:00-17:00"
+	}
+	days := os.Getenv("BUSINESS_DAYS")
+	if days == "" {
+		days = "mon,tue,wed,thu,fri,sat"
+	}
+	tzName := os.Getenv("BUSINESS_TIMEZONE")
+	if tzName == "" {
+		tzName = "Asia/Jakarta"
+	}
+
+	loc, err := time.LoadLocation(tzName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUSINESS_TIMEZONE: %v", err)
+	}
+
+	openStr, closeStr, ok := strings.Cut(hours, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid BUSINESS_HOURS %q, expected HH:MM-HH:MM", hours)
+	}
+	openAt, err := time.Parse("15:04", strings.TrimSpace(openStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUSINESS_HOURS: %v", err)
+	}
+	closeAt, err := time.Parse("15:04", strings.TrimSpace(closeStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUSINESS_HOURS: %v", err)
+	}
+
+	now := time.Now().In(loc)
+	today := strings.ToLower(now.Weekday().String()[:3])
+	openToday := strings.Contains(strings.ToLower(days), today)
+
+	minutes := now.Hour()*60 + now.Minute()
+	isOpen := openToday &&
+		minutes >= openAt.Hour()*60+openAt.Minute() &&
+		minutes < closeAt.Hour()*60+closeAt.Minute()
+
+	return map[string]interface{}{
+		"open_now":     isOpen,
+		"current_time": now.Format("Monday 15:04 MST"),
+		"hours":        hours,
+		"open_days":    days,
+	}, nil
+}
+
+type totalItem struct {
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	UnitPrice int64  `json:"unit_price"`
+}
+
+// calculateTotal does the arithmetic the model tends to get wrong
+func calculateTotal(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	var req struct {
+		Items []totalItem `json:"items"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	type line struct {
+		totalItem
+		Subtotal int64 `json:"subtotal"`
+	}
+
+	var lines []line
+	var total int64
+	for _, item := range req.Items {
+		if item.Quantity < 0 || item.UnitPrice < 0 {
+			return nil, fmt.Errorf("quantity and unit_price must not be negative")
+		}
+		// The catalog's bounds keep every subtotal well inside int64
+		if item.Quantity > database.MaxQuantity || item.UnitPrice > database.MaxUnitPrice {
+			return nil, fmt.Errorf("quantity must be at most %d and unit_price at most %d", database.MaxQuantity, database.MaxUnitPrice)
+		}
+		subtotal := item.Quantity * item.UnitPrice
+		if total > math.MaxInt64-subtotal {
+			return nil, fmt.Errorf("total is too large")
+		}
+		total += subtotal
+		lines = append(lines, line{totalItem: item, Subtotal: subtotal})
+	}
+
+	return map[string]interface{}{
+		"items": lines,
+		"total": total,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCalculateTotal(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      string
+		wantTotal int64
+		wantErr   string
+	}{
+		{"no items", `{"items":[]}`, 0, ""},
+		{"several items", `{"items":[{"quantity":20,"unit_price":4000},{"quantity":3,"unit_price":5000}]}`, 95000, ""},
+		{"negative quantity", `{"items":[{"quantity":-1,"unit_price":4000}]}`, 0, "must not be negative"},
+		{"quantity too large", `{"items":[{"quantity":1000001,"unit_price":1}]}`, 0, "at most"},
+		{"price too large", `{"items":[{"quantity":1,"unit_price":1000000001}]}`, 0, "at most"},
+		{"would overflow int64", `{"items":[{"quantity":9223372036854775807,"unit_price":2}]}`, 0, "at most"},
+		{"largest allowed", `{"items":[{"quantity":1000000,"unit_price":1000000000}]}`, 1_000_000_000_000_000, ""},
+		{"invalid json", `{"items":"x"}`, 0, "invalid arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculateTotal(context.Background(), ToolContext{}, json.RawMessage(tt.args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("calculateTotal: %v", err)
+			}
+			if total := result.(map[string]interface{})["total"].(int64); total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"telecust/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CallbackHandler handles a press of an inline button. Callback data has the form
+// "<prefix>:<arg>" and the handler registered for the prefix receives arg. Handlers
+// must answer the callback query.
+type CallbackHandler func(b *Bot, query *tgbotapi.CallbackQuery, conv *database.Conversation, arg string)
+
+var (
+	callbacksMu      sync.RWMutex
+	callbackHandlers = map[string]CallbackHandler{}
+)
+
+// RegisterCallback routes button presses whose callback data starts with prefix to handler
+func RegisterCallback(prefix string, handler CallbackHandler) {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+
+	callbackHandlers[prefix] = handler
+}
+
+// callbackData builds the callback data for a button handled by the given prefix
+func callbackData(prefix, arg string) string {
+	return prefix + ":" + arg
+}
+
+func init() {
+	RegisterCallback(quickReplyPrefix, handleQuickReply)
+}
+
+// handleCallback records an inline button press as a conversation event and
+// dispatches it to the handler registered for its prefix
+func (b *Bot) handleCallback(query *tgbotapi.CallbackQuery) {
+	log.Printf("[BOT] Received callback from @%s: %s", query.From.UserName, query.Data)
+
+	if query.Message == nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	conv, _, err := database.GetOrCreateConversation(query.Message.Chat.ID, query.From.UserName, query.From.FirstName)
+	if err != nil {
+		log.Printf("[BOT] Error getting conversation: %v", err)
+		b.answerCallback(query.ID, "Terjadi kesalahan, coba lagi nanti")
+		return
+	}
+
+	err = database.SaveConversationEvent(&database.ConversationEvent{
+		ConversationID: conv.ID,
+		Type:           database.EventButtonPress,
+		Label:          buttonLabel(query),
+		Data:           query.Data,
+	})
+	if err != nil {
+		log.Printf("[BOT] Error saving button press: %v", err)
+	}
+
+	prefix, arg, _ := strings.Cut(query.Data, ":")
+
+	callbacksMu.RLock()
+	handler, ok := callbackHandlers[prefix]
+	callbacksMu.RUnlock()
+
+	if !ok {
+		log.Printf("[BOT] No handler for callback data: %s", query.Data)
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	handler(b, query, conv, arg)
+}
+
+// buttonLabel finds the text of the pressed button in the message's keyboard
+func buttonLabel(query *tgbotapi.CallbackQuery) string {
+	if query.Message.ReplyMarkup != nil {
+		for _, row := range query.Message.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData != nil && *button.CallbackData == query.Data {
+					return button.Text
+				}
+			}
+		}
+	}
+	return query.Data
+}
+
+// answerCallback stops the loading indicator on the pressed button, optionally showing a short notice
+func (b *Bot) answerCallback(queryID, text string) {
+	_, err := b.API.Request(tgbotapi.NewCallback(queryID, text))
+	if err != nil {
+		log.Printf("[BOT] Error answering callback: %v", err)
+	}
+}
+
+// quickReplyPrefix is the callback prefix of configured quick-reply buttons, e.g. "qr:3"
+const quickReplyPrefix = "qr"
+
+// quickReplyKeyboard builds the inline keyboard of quick replies shown at the given
+// place, or nil when there are none
+func quickReplyKeyboard(showOn string) *tgbotapi.InlineKeyboardMarkup {
+	replies, err := database.ListEnabledQuickReplies(showOn)
+	if err != nil {
+		log.Printf("[BOT] Error loading quick replies: %v", err)
+		return nil
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+
+	// Two buttons per row keeps labels readable on phones
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, reply := range replies {
+		var button tgbotapi.InlineKeyboardButton
+		if reply.Action == database.QuickReplyURL {
+			button = tgbotapi.NewInlineKeyboardButtonURL(reply.Label, reply.Payload)
+		} else {
+			button = tgbotapi.NewInlineKeyboardButtonData(reply.Label, callbackData(quickReplyPrefix, strconv.Itoa(reply.ID)))
+		}
+
+		if i%2 == 0 {
+			rows = append(rows, []tgbotapi.InlineKeyboardButton{button})
+		} else {
+			rows[len(rows)-1] = append(rows[len(rows)-1], button)
+		}
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// handleQuickReply runs the action of a configured quick-reply button
+func handleQuickReply(b *Bot, query *tgbotapi.CallbackQuery, conv *database.Conversation, arg string) {
+	chatID := query.Message.Chat.ID
+
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	reply, err := database.GetQuickReply(id)
+	if err != nil {
+		log.Printf("[BOT] Error loading quick reply %d: %v", id, err)
+		b.answerCallback(query.ID, "Terjadi kesalahan, coba lagi nanti")
+		return
+	}
+	if reply == nil || !reply.Enabled {
+		b.answerCallback(query.ID, "Tombol ini sudah tidak tersedia")
+		return
+	}
+
+	b.answerCallback(query.ID, "")
+
+	switch reply.Action {
+	case database.QuickReplyMessage:
+		// Treat the button as if the customer typed its text
+		err = database.SaveMessage(conv.ID, "user", reply.Payload)
+		if err != nil {
+			log.Printf("[BOT] Error saving message: %v", err)
+			return
+		}
+		b.respond(chatID, conv, reply.Payload)
+
+	case database.QuickReplyHandoff:
+		b.sendHandoffMessage(chatID, conv)
+		b.handOff(conv, HandoffButton, "Customer menekan tombol "+strconv.Quote(reply.Label))
+	}
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"strconv"
+	"telecust/database"
+	"telecust/events"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandleQuickReplyHandoff(t *testing.T) {
+	useTestDB(t)
+	useHandoffPolicy(t, true)
+	handoff.message = "Admin segera membalas"
+
+	b, telegram := newTestBot(t)
+	conv := newTestConversation(t, 4000)
+	reply := &database.QuickReply{Label: "Chat admin", Action: database.QuickReplyHandoff, ShowOn: "always", Enabled: true}
+	if err := database.CreateQuickReply(reply); err != nil {
+		t.Fatalf("CreateQuickReply: %v", err)
+	}
+
+	ch, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	query := &tgbotapi.CallbackQuery{ID: "q1", Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: conv.TelegramChatID}}}
+	handleQuickReply(b, query, conv, strconv.Itoa(reply.ID))
+
+	if sent := telegram.sent("sendMessage"); len(sent) != 1 || sent[0] != "Admin segera membalas" {
+		t.Errorf("sent %q, want the configured handoff message", sent)
+	}
+
+	stored, err := database.GetConversation(conv.ID)
+	if err != nil || stored.IsBotActive {
+		t.Errorf("bot still active after handoff: %+v, %v", stored, err)
+	}
+
+	convEvents, err := database.GetConversationEvents(conv.ID)
+	if err != nil || len(convEvents) != 1 || convEvents[0].Type != database.EventHandoff || convEvents[0].Data != HandoffButton {
+		t.Errorf("conversation events = %+v, %v, want one button handoff", convEvents, err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-ch:
+			if event.Type == events.HandoffRequested && event.ConversationID == conv.ID {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no HandoffRequested event published")
+		}
+	}
+}
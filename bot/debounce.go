@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"telecust/database"
+	"time"
+)
+
+// debouncer collects the messages a customer sends in quick succession so the AI
+// answers them once. Every message restarts the conversation's window; when it
+// passes without a new message the collected texts are answered together.
+type debouncer struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[int]*pendingTurn // By conversation ID
+}
+
+// pendingTurn is a burst of messages waiting for the window to pass
+type pendingTurn struct {
+	chatID int64
+	texts  []string
+	timer  *time.Timer
+}
+
+// debounceWindowFromEnv reads MESSAGE_DEBOUNCE_MS, 0 answers every message right away
+func debounceWindowFromEnv() time.Duration {
+	if env := os.Getenv("MESSAGE_DEBOUNCE_MS"); env != "" {
+		if ms, err := strconv.Atoi(env); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{
+		window:  window,
+		pending: make(map[int]*pendingTurn),
+	}
+}
+
+// queueResponse answers a customer message with the AI, merged with the messages
+// that follow it within the debounce window. The message must already be saved.
+func (b *Bot) queueResponse(chatID int64, conv *database.Conversation, text string) {
+	d := b.debouncer
+	if d == nil || d.window <= 0 {
+		b.respond(chatID, conv, text)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	turn, ok := d.pending[conv.ID]
+	if !ok {
+		turn = &pendingTurn{chatID: chatID}
+		d.pending[conv.ID] = turn
+		turn.timer = time.AfterFunc(d.window, func() { b.flushTurn(conv.ID, turn) })
+	} else {
+		turn.timer.Reset(d.window)
+	}
+	turn.texts = append(turn.texts, text)
+}
+
+// flushTurn answers a burst once its window has passed. It runs on the chat's queue
+// so it stays in order with the updates that arrive meanwhile.
+func (b *Bot) flushTurn(conversationID int, turn *pendingTurn) {
+	d := b.debouncer
+
+	// A timer reset just as it fired runs again; the turn is already answered then
+	d.mu.Lock()
+	if d.pending[conversationID] != turn {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, conversationID)
+	d.mu.Unlock()
+
+	b.dispatcher.enqueue(turn.chatID, func() {
+		// Load the conversation again, an admin may have taken over or deleted it during the window
+		conv, err := database.GetConversation(conversationID)
+		if err != nil {
+			log.Printf("[BOT] Error getting conversation: %v", err)
+			return
+		}
+		if conv == nil {
+			log.Printf("[BOT] Conversation %d no longer exists, dropping %d pending messages", conversationID, len(turn.texts))
+			return
+		}
+
+		if len(turn.texts) > 1 {
+			log.Printf("[BOT] Answering %d messages from chat %d together", len(turn.texts), turn.chatID)
+		}
+		b.respond(turn.chatID, conv, strings.Join(turn.texts, "\n"))
+	})
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// defaultMaxConcurrency is how many chats are processed at the same time unless
+// BOT_MAX_CONCURRENCY says otherwise
+const defaultMaxConcurrency = 8
+
+// dispatcher runs the updates of one chat one after another, in the order they
+// arrived, while different chats are processed in parallel. At most cap(slots)
+// updates run at once across all chats; the rest wait in their chat's queue.
+type dispatcher struct {
+	mu     sync.Mutex
+	queues map[int64][]func() // Pending work per chat, present while its worker runs
+	slots  chan struct{}
+}
+
+func newDispatcher(maxConcurrency int) *dispatcher {
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+	return &dispatcher{
+		queues: make(map[int64][]func()),
+		slots:  make(chan struct{}, maxConcurrency),
+	}
+}
+
+// maxConcurrencyFromEnv reads BOT_MAX_CONCURRENCY
+func maxConcurrencyFromEnv() int {
+	if env := os.Getenv("BOT_MAX_CONCURRENCY"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxConcurrency
+}
+
+// enqueue schedules work for a chat. A worker is started for the chat if none is
+// running; it exits once the chat's queue is empty.
+func (d *dispatcher) enqueue(chatID int64, work func()) {
+	d.mu.Lock()
+	pending, running := d.queues[chatID]
+	d.queues[chatID] = append(pending, work)
+	d.mu.Unlock()
+
+	if !running {
+		go d.run(chatID)
+	}
+}
+
+func (d *dispatcher) run(chatID int64) {
+	for {
+		d.mu.Lock()
+		pending := d.queues[chatID]
+		if len(pending) == 0 {
+			delete(d.queues, chatID)
+			d.mu.Unlock()
+			return
+		}
+		work := pending[0]
+		d.queues[chatID] = pending[1:]
+		d.mu.Unlock()
+
+		d.slots <- struct{}{}
+		d.do(chatID, work)
+		<-d.slots
+	}
+}
+
+// do runs one piece of work, keeping a panic from stopping the chat's worker
+func (d *dispatcher) do(chatID int64, work func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[BOT] Panic while handling update for chat %d: %v", chatID, r)
+		}
+	}()
+	work()
+}
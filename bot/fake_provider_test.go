@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"telecust/database"
+	"testing"
+)
+
+// fakeProvider answers completions from a script and records the requests it got
+type fakeProvider struct {
+	mu        sync.Mutex
+	responses []fakeResponse
+	requests  []fakeRequest
+}
+
+// fakeResponse is one scripted completion; a non-nil err fails the request
+type fakeResponse struct {
+	completion Completion
+	err        error
+}
+
+type fakeRequest struct {
+	messages []Message
+	opts     CompletionOptions
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+// Complete returns the next scripted response, repeating the last one when the script runs out
+func (p *fakeProvider) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (*Completion, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, fakeRequest{messages: append([]Message(nil), messages...), opts: opts})
+	if len(p.responses) == 0 {
+		return &Completion{Content: "ok", Model: "fake-model"}, nil
+	}
+
+	next := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	if next.err != nil {
+		return nil, next.err
+	}
+	completion := next.completion
+	if completion.Model == "" {
+		completion.Model = "fake-model"
+	}
+	return &completion, nil
+}
+
+// fakeStreamingProvider streams each scripted reply in chunks of chunkSize bytes
+type fakeStreamingProvider struct {
+	fakeProvider
+	chunkSize int
+}
+
+func (p *fakeStreamingProvider) Stream(ctx context.Context, messages []Message, opts CompletionOptions, onDelta func(delta string)) (*Completion, error) {
+	completion, err := p.Complete(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for text := completion.Content; text != ""; {
+		n := p.chunkSize
+		if n <= 0 || n > len(text) {
+			n = len(text)
+		}
+		onDelta(text[:n])
+		text = text[n:]
+	}
+	return completion, nil
+}
+
+// useFakeProvider makes p the active provider for the rest of the test
+func useFakeProvider(t *testing.T, p Provider) {
+	t.Helper()
+
+	previous := activeProvider
+	SetProvider(p)
+	t.Cleanup(func() { SetProvider(previous) })
+}
+
+// useTestDB opens a fresh database in a temporary directory
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+// newTestConversation creates a conversation to run queries in
+func newTestConversation(t *testing.T, chatID int64) *database.Conversation {
+	t.Helper()
+
+	conv, _, err := database.GetOrCreateConversation(chatID, "customer", "Customer")
+	if err != nil {
+		t.Fatalf("GetOrCreateConversation: %v", err)
+	}
+	return conv
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram is a Bot API server that records every request and accepts all of them,
+// except those posted into a thread listed in goneThreads
+type fakeTelegram struct {
+	mu          sync.Mutex
+	requests    []fakeTelegramRequest
+	goneThreads map[string]bool
+}
+
+type fakeTelegramRequest struct {
+	method string
+	params map[string]string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	r.ParseMultipartForm(1 << 20)
+
+	params := map[string]string{}
+	for key, values := range r.Form {
+		params[key] = values[0]
+	}
+
+	var result interface{} = true
+	switch {
+	case method == "getMe":
+		result = tgbotapi.User{ID: 1, IsBot: true, UserName: "test_bot"}
+	case method == "createForumTopic":
+		result = map[string]interface{}{"message_thread_id": 42, "name": params["name"]}
+	case strings.HasPrefix(method, "send"), strings.HasPrefix(method, "edit"):
+		result = tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1}}
+	}
+
+	f.mu.Lock()
+	if method != "getMe" {
+		f.requests = append(f.requests, fakeTelegramRequest{method: method, params: params})
+	}
+	gone := f.goneThreads[params["message_thread_id"]]
+	f.mu.Unlock()
+
+	if gone {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error_code":  http.StatusBadRequest,
+			"description": "Bad Request: message thread not found",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// sent returns the text of every message sent with the given method
+func (f *fakeTelegram) sent(method string) []string {
+	return f.params(method, "text")
+}
+
+// params returns one parameter of every request made with the given method
+func (f *fakeTelegram) params(method, name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var values []string
+	for _, req := range f.requests {
+		if req.method == method {
+			values = append(values, req.params[name])
+		}
+	}
+	return values
+}
+
+// newTestBot returns a bot talking to a fake Bot API server
+func newTestBot(t *testing.T) (*Bot, *fakeTelegram) {
+	t.Helper()
+
+	fake := &fakeTelegram{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("test-token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient: %v", err)
+	}
+	return &Bot{API: api}, fake
+}
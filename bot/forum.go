@@ -0,0 +1,329 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"telecust/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// forumSentByPrefix marks admin messages written in a staff forum topic, so they are
+// not mirrored back into the topic they came from
+const forumSentByPrefix = "telegram:"
+
+// maxTopicName is the longest forum topic name Telegram accepts
+const maxTopicName = 128
+
+// topicFields holds the forum fields of an update, which tgbotapi v5.5.1 does not decode
+type topicFields struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		MessageThreadID int  `json:"message_thread_id"`
+		IsTopicMessage  bool `json:"is_topic_message"`
+	} `json:"message"`
+}
+
+// decodeUpdate decodes an update from Telegram together with the forum topic its
+// message was posted in, 0 outside forum topics
+func decodeUpdate(data []byte) (tgbotapi.Update, int, error) {
+	var update tgbotapi.Update
+	err := json.Unmarshal(data, &update)
+	if err != nil {
+		return update, 0, err
+	}
+
+	var fields topicFields
+	err = json.Unmarshal(data, &fields)
+	if err != nil || fields.Message == nil || !fields.Message.IsTopicMessage {
+		return update, 0, nil
+	}
+	return update, fields.Message.MessageThreadID, nil
+}
+
+// forumQueue holds stored messages waiting to be mirrored, in the order they were
+// saved. It grows as needed, so a slow Bot API delays the mirror but never makes it
+// skip a message.
+type forumQueue struct {
+	mu       sync.Mutex
+	ready    *sync.Cond
+	messages []*database.Message
+}
+
+func newForumQueue() *forumQueue {
+	q := &forumQueue{}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a message to the end of the queue without blocking
+func (q *forumQueue) push(msg *database.Message) {
+	q.mu.Lock()
+	q.messages = append(q.messages, msg)
+	q.mu.Unlock()
+	q.ready.Signal()
+}
+
+// pop removes the oldest message, waiting until there is one
+func (q *forumQueue) pop() *database.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.messages) == 0 {
+		q.ready.Wait()
+	}
+	msg := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+	return msg
+}
+
+// mirrorToForum posts every stored message into its conversation's topic in the staff
+// forum until the process exits, one at a time in the order they were saved
+func (b *Bot) mirrorToForum(queue *forumQueue) {
+	for {
+		msg := queue.pop()
+		if msg.SenderType == "admin" && strings.HasPrefix(msg.SentBy, forumSentByPrefix) {
+			continue
+		}
+		b.mirrorMessage(msg)
+	}
+}
+
+// mirrorMessage posts a message into its conversation's topic, creating the topic on
+// first use and again if staff deleted it
+func (b *Bot) mirrorMessage(msg *database.Message) {
+	for attempt := 0; attempt < 2; attempt++ {
+		topicID, err := b.staffTopic(msg.ConversationID)
+		if err != nil {
+			log.Printf("[FORUM] Error getting topic for conversation %d: %v", msg.ConversationID, err)
+			return
+		}
+
+		err = b.postToTopic(topicID, msg)
+		if err == nil {
+			return
+		}
+		if !isTopicGone(err) {
+			log.Printf("[FORUM] Error mirroring message %d: %v", msg.ID, err)
+			return
+		}
+
+		log.Printf("[FORUM] Topic %d of conversation %d is gone, creating a new one", topicID, msg.ConversationID)
+		if err := database.SetStaffTopic(msg.ConversationID, 0); err != nil {
+			log.Printf("[FORUM] Error forgetting topic: %v", err)
+			return
+		}
+	}
+}
+
+// isTopicGone reports whether the Bot API refused a request because its forum topic
+// no longer exists
+func isTopicGone(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, "message thread not found")
+}
+
+// staffTopic returns the forum topic of a conversation, creating it if needed
+func (b *Bot) staffTopic(conversationID int) (int, error) {
+	topicID, err := database.GetStaffTopic(conversationID)
+	if err != nil || topicID != 0 {
+		return topicID, err
+	}
+
+	conv, err := database.GetConversation(conversationID)
+	if err != nil {
+		return 0, err
+	}
+	if conv == nil {
+		return 0, fmt.Errorf("conversation %d not found", conversationID)
+	}
+
+	name := []rune(staffCustomerLabel(conv))
+	if len(name) > maxTopicName {
+		name = name[:maxTopicName]
+	}
+
+	params := tgbotapi.Params{"name": string(name)}
+	params.AddNonZero64("chat_id", b.staff.forumChatID)
+	resp, err := b.API.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var topic struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}
+	err = json.Unmarshal(resp.Result, &topic)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("[FORUM] Created topic %d for conversation %d", topic.MessageThreadID, conversationID)
+	return topic.MessageThreadID, database.SetStaffTopic(conversationID, topic.MessageThreadID)
+}
+
+// topicFileMethods maps attachment kinds to the Bot API method and field that resend
+// a file by its file_id
+var topicFileMethods = map[string][2]string{
+	database.AttachmentPhoto:    {"sendPhoto", "photo"},
+	database.AttachmentDocument: {"sendDocument", "document"},
+	database.AttachmentVoice:    {"sendVoice", "voice"},
+	database.AttachmentAudio:    {"sendAudio", "audio"},
+	database.AttachmentVideo:    {"sendVideo", "video"},
+	database.AttachmentSticker:  {"sendSticker", "sticker"},
+}
+
+// postToTopic sends a message into a forum topic, labelled with who wrote it.
+// Attachments are resent by file_id with the text as their caption.
+func (b *Bot) postToTopic(topicID int, msg *database.Message) error {
+	text := topicSenderLabel(msg)
+	if msg.MessageText != "" {
+		text += "\n" + msg.MessageText
+	}
+
+	for _, att := range msg.Attachments {
+		method, ok := topicFileMethods[att.Kind]
+		if !ok {
+			continue
+		}
+
+		params := b.topicParams(topicID)
+		params[method[1]] = att.FileID
+		if att.Kind != database.AttachmentSticker {
+			params["caption"] = text
+			text = ""
+		}
+		_, err := b.API.MakeRequest(method[0], params)
+		if err != nil {
+			return err
+		}
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	params := b.topicParams(topicID)
+	params["text"] = text
+	_, err := b.API.MakeRequest("sendMessage", params)
+	return err
+}
+
+func (b *Bot) topicParams(topicID int) tgbotapi.Params {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", b.staff.forumChatID)
+	params.AddNonZero("message_thread_id", topicID)
+	return params
+}
+
+// topicSenderLabel names the author of a mirrored message
+func topicSenderLabel(msg *database.Message) string {
+	switch msg.SenderType {
+	case "user":
+		return "Customer:"
+	case "bot":
+		return "Bot:"
+	default:
+		if msg.SentBy != "" {
+			return "Admin " + msg.SentBy + ":"
+		}
+		return "Admin:"
+	}
+}
+
+// handleTopicReply relays an agent's message in a conversation's forum topic to the
+// customer and takes the conversation over for them: the bot is paused and the
+// conversation assigned to the agent. Only text from staff linked to a dashboard
+// agent is relayed.
+func (b *Bot) handleTopicReply(message *tgbotapi.Message, topicID int) {
+	if message.From == nil || message.From.IsBot {
+		return
+	}
+
+	conv, err := database.GetConversationByStaffTopic(topicID)
+	if err != nil {
+		log.Printf("[FORUM] Error finding conversation of topic %d: %v", topicID, err)
+		return
+	}
+	if conv == nil {
+		return
+	}
+
+	if message.Text == "" {
+		// Service messages such as topic renames carry neither text nor a file
+		if attachmentFromMessage(message) != nil {
+			b.replyInTopic(message, topicID, "Only text replies are sent to the customer. Send files from the dashboard.")
+		}
+		return
+	}
+
+	agent, denied := staffAgent(message.From)
+	if agent == nil {
+		log.Printf("[FORUM] Rejected reply to conversation %d from Telegram user %d", conv.ID, message.From.ID)
+		b.replyInTopic(message, topicID, "Not sent to the customer. "+denied)
+		return
+	}
+
+	sentBy := forumSentByPrefix + agent.Username
+	log.Printf("[FORUM] Relaying reply from %s to conversation %d", sentBy, conv.ID)
+
+	err = b.SendMessageAsAdmin(conv.TelegramChatID, message.Text, conv.ID, sentBy)
+	if err != nil {
+		log.Printf("[FORUM] Error relaying reply to conversation %d: %v", conv.ID, err)
+		b.replyInTopic(message, topicID, "Could not send this to the customer: "+err.Error())
+		return
+	}
+	auditStaffAction(agent, "message.send", conv.ID, nil, map[string]string{"message": message.Text})
+
+	if conv.IsBotActive || conv.AssignedAgent != agent.Username {
+		err = assignToAgent(conv, agent)
+		if err != nil {
+			log.Printf("[FORUM] Error assigning conversation %d to %s: %v", conv.ID, agent.Username, err)
+		}
+	}
+}
+
+// assignToAgent pauses the bot for a conversation and assigns it to the agent who is
+// replying in its topic, and audits the take-over
+func assignToAgent(conv *database.Conversation, agent *database.AdminUser) error {
+	before := conv.AssignmentState()
+
+	if conv.IsBotActive {
+		err := database.SetBotActive(conv.ID, false)
+		if err != nil {
+			return err
+		}
+		conv.IsBotActive = false
+	}
+
+	if conv.AssignedAgent != agent.Username {
+		err := database.AssignConversation(conv.ID, agent.Username)
+		if err != nil {
+			return err
+		}
+		conv.AssignedAgent = agent.Username
+	}
+
+	auditStaffAction(agent, "conversation.takeover", conv.ID, before, conv.AssignmentState())
+	return nil
+}
+
+// replyInTopic answers an agent's message in its forum topic
+func (b *Bot) replyInTopic(message *tgbotapi.Message, topicID int, text string) {
+	params := b.topicParams(topicID)
+	params["text"] = text
+	params.AddNonZero("reply_to_message_id", message.MessageID)
+	_, err := b.API.MakeRequest("sendMessage", params)
+	if err != nil {
+		log.Printf("[FORUM] Error replying in topic %d: %v", topicID, err)
+	}
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"telecust/database"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestMirrorToForumKeepsEveryMessageInOrder(t *testing.T) {
+	useTestDB(t)
+	b, telegram := newTestBot(t)
+	b.staff.forumChatID = -200
+	conv := newTestConversation(t, 6000)
+
+	// Far more messages than the event bus buffers, queued before the mirror runs
+	const count = 300
+	queue := newForumQueue()
+	queue.push(&database.Message{ConversationID: conv.ID, SenderType: "admin", SentBy: forumSentByPrefix + "alice", MessageText: "from the topic"})
+	for i := 0; i < count; i++ {
+		queue.push(&database.Message{ID: i + 1, ConversationID: conv.ID, SenderType: "user", MessageText: fmt.Sprint(i)})
+	}
+
+	go b.mirrorToForum(queue)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(telegram.sent("sendMessage")) < count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sent := telegram.sent("sendMessage")
+	if len(sent) != count {
+		t.Fatalf("mirrored %d messages, want %d", len(sent), count)
+	}
+	for i, text := range sent {
+		if want := fmt.Sprintf("Customer:\n%d", i); text != want {
+			t.Fatalf("message %d = %q, want %q", i, text, want)
+		}
+	}
+	if topics := telegram.params("createForumTopic", "name"); len(topics) != 1 {
+		t.Errorf("created %d topics, want 1", len(topics))
+	}
+}
+
+func TestMirrorMessageRecreatesDeletedTopic(t *testing.T) {
+	useTestDB(t)
+	b, telegram := newTestBot(t)
+	b.staff.forumChatID = -200
+	telegram.goneThreads = map[string]bool{"7": true}
+	conv := newTestConversation(t, 6001)
+	if err := database.SetStaffTopic(conv.ID, 7); err != nil {
+		t.Fatalf("SetStaffTopic: %v", err)
+	}
+
+	b.mirrorMessage(&database.Message{ID: 1, ConversationID: conv.ID, SenderType: "user", MessageText: "hello"})
+
+	if topics := telegram.params("createForumTopic", "name"); len(topics) != 1 {
+		t.Fatalf("created %d topics, want 1", len(topics))
+	}
+	threads := telegram.params("sendMessage", "message_thread_id")
+	if want := []string{"7", "42"}; strings.Join(threads, ",") != strings.Join(want, ",") {
+		t.Errorf("sent into threads %v, want %v", threads, want)
+	}
+	topicID, err := database.GetStaffTopic(conv.ID)
+	if err != nil {
+		t.Fatalf("GetStaffTopic: %v", err)
+	}
+	if topicID != 42 {
+		t.Errorf("stored topic %d, want 42", topicID)
+	}
+}
+
+func TestIsTopicGone(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deleted topic", &tgbotapi.Error{Code: 400, Message: "Bad Request: message thread not found"}, true},
+		{"other bad request", &tgbotapi.Error{Code: 400, Message: "Bad Request: message text is empty"}, false},
+		{"rate limited", &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5"}, false},
+		{"network error", fmt.Errorf("dial tcp: message thread not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTopicGone(tt.err); got != tt.want {
+				t.Errorf("isTopicGone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleTopicReply(t *testing.T) {
+	tests := []struct {
+		name         string
+		fromID       int64
+		wantRelayed  bool
+		wantReply    string
+		wantAssigned string
+	}{
+		{"unlinked sender", 900, false, "not linked", ""},
+		{"viewer", 901, false, "cannot handle conversations", ""},
+		{"agent", 902, true, "", "alice"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			b, telegram := newTestBot(t)
+			b.staff.forumChatID = -200
+			newTestAdmin(t, "viewer1", database.RoleViewer, 901)
+			newTestAdmin(t, "alice", database.RoleAgent, 902)
+
+			conv := newTestConversation(t, int64(6100+i))
+			if err := database.AssignConversation(conv.ID, "bob"); err != nil {
+				t.Fatalf("AssignConversation: %v", err)
+			}
+			if err := database.SetStaffTopic(conv.ID, 42); err != nil {
+				t.Fatalf("SetStaffTopic: %v", err)
+			}
+
+			b.handleTopicReply(&tgbotapi.Message{
+				MessageID: 9,
+				From:      &tgbotapi.User{ID: tt.fromID, FirstName: "Staff"},
+				Chat:      &tgbotapi.Chat{ID: -200},
+				Text:      "Stoknya ada kak",
+			}, 42)
+
+			chats := telegram.params("sendMessage", "chat_id")
+			texts := telegram.sent("sendMessage")
+			relayed := len(chats) == 1 && chats[0] == strconv.FormatInt(conv.TelegramChatID, 10) && texts[0] == "Stoknya ada kak"
+			if relayed != tt.wantRelayed {
+				t.Errorf("sent %q to %q, relayed = %v, want %v", texts, chats, relayed, tt.wantRelayed)
+			}
+			if tt.wantReply != "" && (len(texts) != 1 || !strings.Contains(texts[0], tt.wantReply)) {
+				t.Errorf("replied %q in the topic, want it to contain %q", texts, tt.wantReply)
+			}
+
+			stored, err := database.GetConversation(conv.ID)
+			if err != nil {
+				t.Fatalf("GetConversation: %v", err)
+			}
+			entries := staffAudit(t, conv.ID)
+
+			if !tt.wantRelayed {
+				if !stored.IsBotActive || stored.AssignedAgent != "bob" || len(entries) != 0 {
+					t.Errorf("rejected reply changed the conversation: %+v, audit %+v", stored, entries)
+				}
+				return
+			}
+
+			if stored.IsBotActive || stored.AssignedAgent != tt.wantAssigned {
+				t.Errorf("IsBotActive = %v, AssignedAgent = %q, want paused and %q", stored.IsBotActive, stored.AssignedAgent, tt.wantAssigned)
+			}
+			var actions []string
+			for _, e := range entries {
+				if e.Actor != "alice" || e.IP != staffAuditSource {
+					t.Errorf("audit entry %+v not recorded for alice from Telegram", e)
+				}
+				actions = append(actions, e.Action)
+			}
+			if strings.Join(actions, ",") != "conversation.takeover,message.send" {
+				t.Errorf("audit actions = %q, want the message and the take-over", actions)
+			}
+		})
+	}
+}
@@ -1,14 +1,39 @@
 package bot
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
 	"telecust/database"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type Bot struct {
 	API *tgbotapi.BotAPI
+
+	// Streaming progressively edits the reply message while the AI is still answering
+	Streaming          bool
+	StreamEditInterval time.Duration
+
+	// Webhook mode receives updates on WebhookPath instead of long polling
+	WebhookURL    string
+	WebhookSecret string
+
+	// Updates of one chat are handled in order, different chats in parallel
+	dispatcher *dispatcher
+
+	// Messages sent in quick succession are answered together
+	debouncer *debouncer
+
+	// Paused conversations whose agent stays quiet are handed back to the bot
+	takeover takeoverTimeout
+
+	// Notifications for admins are posted to a staff group
+	staff staffGroup
 }
 
 var GlobalBot *Bot
@@ -22,23 +47,141 @@ func InitBot(token string) error {
 	bot.Debug = false
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	GlobalBot = &Bot{API: bot}
-	return nil
+	GlobalBot = &Bot{
+		API:                bot,
+		Streaming:          os.Getenv("AI_STREAM") == "true",
+		StreamEditInterval: defaultStreamEditInterval,
+		dispatcher:         newDispatcher(maxConcurrencyFromEnv()),
+		debouncer:          newDebouncer(debounceWindowFromEnv()),
+		takeover:           takeoverTimeoutFromEnv(),
+		staff:              staffGroupFromEnv(),
+	}
+	handoff = newHandoffPolicy()
+
+	if envInterval := os.Getenv("AI_STREAM_EDIT_INTERVAL_MS"); envInterval != "" {
+		if ms, err := strconv.Atoi(envInterval); err == nil && ms > 0 {
+			GlobalBot.StreamEditInterval = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	if GlobalBot.Streaming {
+		log.Printf("Streaming replies enabled (edit interval: %s)", GlobalBot.StreamEditInterval)
+	}
+	log.Printf("Handling up to %d chats concurrently", cap(GlobalBot.dispatcher.slots))
+	if GlobalBot.debouncer.window > 0 {
+		log.Printf("Merging messages sent within %s into one reply", GlobalBot.debouncer.window)
+	}
+	if !handoff.enabled {
+		log.Printf("Automatic handoff to agents is disabled")
+	}
+	if GlobalBot.staff.chatID != 0 {
+		log.Printf("Posting staff notifications to chat %d", GlobalBot.staff.chatID)
+	}
+	if GlobalBot.staff.forumChatID != 0 {
+		log.Printf("Mirroring conversations into forum topics of chat %d", GlobalBot.staff.forumChatID)
+	}
+	if GlobalBot.takeover.minutes > 0 {
+		log.Printf("Resuming the bot after %d minutes without an admin reply", GlobalBot.takeover.minutes)
+	}
+
+	return GlobalBot.configureWebhook(os.Getenv("TELEGRAM_WEBHOOK_URL"), os.Getenv("TELEGRAM_WEBHOOK_SECRET"))
 }
 
+// Start receives updates and watches for takeover timeouts. In webhook mode it only
+// registers the webhook, updates then arrive through HandleWebhook; otherwise it long
+// polls Telegram.
 func (b *Bot) Start() {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	go b.watchTakeovers()
+	if b.staff.forumChatID != 0 {
+		queue := newForumQueue()
+		database.OnMessageSaved(queue.push)
+		go b.mirrorToForum(queue)
+	}
 
-	updates := b.API.GetUpdatesChan(u)
+	if b.WebhookEnabled() {
+		err := b.setWebhook()
+		if err != nil {
+			log.Fatalf("Failed to register webhook: %v", err)
+		}
+		log.Printf("Receiving updates via webhook at %s", b.WebhookURL)
+		return
+	}
+
+	b.deleteWebhook()
+	b.pollUpdates()
+}
+
+// pollUpdates long polls Telegram for updates. getUpdates is called by hand rather than
+// through GetUpdatesChan so the forum topic of each message can be decoded as well.
+func (b *Bot) pollUpdates() {
+	offset := 0
+	for {
+		params := tgbotapi.Params{}
+		params.AddNonZero("offset", offset)
+		params.AddNonZero("timeout", 60)
+
+		resp, err := b.API.MakeRequest("getUpdates", params)
+		if err != nil {
+			log.Printf("[BOT] Failed to get updates, retrying in 3 seconds: %v", err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
 
-	for update := range updates {
-		if update.Message == nil {
+		var updates []json.RawMessage
+		err = json.Unmarshal(resp.Result, &updates)
+		if err != nil {
+			log.Printf("[BOT] Error decoding updates: %v", err)
+			time.Sleep(3 * time.Second)
 			continue
 		}
 
-		go b.handleMessage(update.Message)
+		for _, data := range updates {
+			update, topicID, err := decodeUpdate(data)
+			if err != nil {
+				log.Printf("[BOT] Error decoding update: %v", err)
+			}
+			if update.UpdateID >= offset {
+				offset = update.UpdateID + 1
+			}
+			if err == nil {
+				b.handleUpdate(update, topicID)
+			}
+		}
+	}
+}
+
+// handleUpdate dispatches an update received by long polling or the webhook. Updates
+// are queued per chat so a customer's messages and button presses are answered in
+// the order they were sent. topicID is the staff forum topic of the message, if any.
+func (b *Bot) handleUpdate(update tgbotapi.Update, topicID int) {
+	if query := update.CallbackQuery; query != nil {
+		if query.Message != nil && b.isStaffChat(query.Message.Chat.ID) {
+			go b.handleStaffCallback(query)
+			return
+		}
+		if query.Message == nil {
+			go b.handleCallback(query)
+			return
+		}
+		b.dispatcher.enqueue(query.Message.Chat.ID, func() { b.handleCallback(query) })
+		return
+	}
+
+	message := update.Message
+	if message == nil {
+		return
+	}
+
+	// Messages in the staff group are between admins, not from a customer, except
+	// replies in a conversation's forum topic which are relayed to its customer
+	if b.isStaffChat(message.Chat.ID) {
+		if topicID != 0 && message.Chat.ID == b.staff.forumChatID {
+			b.dispatcher.enqueue(message.Chat.ID, func() { b.handleTopicReply(message, topicID) })
+		}
+		return
 	}
+
+	b.dispatcher.enqueue(message.Chat.ID, func() { b.handleMessage(message) })
 }
 
 func (b *Bot) handleMessage(message *tgbotapi.Message) {
@@ -46,7 +189,7 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		message.From.UserName, message.Chat.ID, message.Text)
 
 	// Get or create conversation
-	conv, err := database.GetOrCreateConversation(
+	conv, created, err := database.GetOrCreateConversation(
 		message.Chat.ID,
 		message.From.UserName,
 		message.From.FirstName,
@@ -56,8 +199,29 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
+	if created {
+		b.notifyStaff(conv, "New conversation", firstNonEmpty(message.Text, message.Caption))
+	}
+
 	log.Printf("[BOT] Conversation ID: %d, Bot Active: %v", conv.ID, conv.IsBotActive)
 
+	// Photos, documents, voice notes and stickers are saved with their file details
+	if att := attachmentFromMessage(message); att != nil {
+		log.Printf("[BOT] Message carries a %s (file_id: %s, %d bytes)", att.Kind, att.FileID, att.FileSize)
+
+		err = database.SaveMessageWithAttachment(conv.ID, "user", "", message.Caption, att)
+		if err != nil {
+			log.Printf("[BOT] Error saving message: %v", err)
+			return
+		}
+
+		b.respondToAttachment(message.Chat.ID, conv, database.Message{
+			MessageText: message.Caption,
+			Attachments: []database.Attachment{*att},
+		})
+		return
+	}
+
 	// Save user message
 	err = database.SaveMessage(conv.ID, "user", message.Text)
 	if err != nil {
@@ -70,41 +234,92 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		log.Printf("[BOT] Command detected: /%s", message.Command())
 		switch message.Command() {
 		case "start", "help":
-			b.sendMessage(message.Chat.ID, "Halo! Saya siap membantu Anda. Silakan tanyakan apa saja!")
+			b.sendReply(message.Chat.ID, "Halo! Saya siap membantu Anda. Silakan tanyakan apa saja!", quickReplyKeyboard(database.ShowOnStart))
 			database.SaveMessage(conv.ID, "bot", "Halo! Saya siap membantu Anda. Silakan tanyakan apa saja!")
 			return
 		}
 	}
 
+	b.queueResponse(message.Chat.ID, conv, message.Text)
+}
+
+// respond answers a customer message with the AI unless an admin has taken over the conversation
+func (b *Bot) respond(chatID int64, conv *database.Conversation, text string) {
 	// Check if bot is active for this conversation
 	if !conv.IsBotActive {
 		// Bot is in takeover mode, don't respond
-		log.Printf("[BOT] Bot inactive for chat %d, admin mode - not responding", message.Chat.ID)
+		log.Printf("[BOT] Bot inactive for chat %d, admin mode - not responding", chatID)
 		return
 	}
 
-	// Query knowledge base
-	log.Printf("[BOT] Loading knowledge base...")
-	kb, err := database.GetKnowledgeBase()
-	if err != nil {
-		log.Printf("[BOT] Error getting knowledge base: %v", err)
-		kb = ""
+	// A customer asking for a human gets one without waiting for the AI
+	if keyword := handoff.matchKeyword(text); keyword != "" {
+		b.sendHandoffMessage(chatID, conv)
+		b.handOff(conv, HandoffKeyword, fmt.Sprintf("Customer minta bicara dengan admin (%q)", keyword))
+		return
 	}
 
+	// Query knowledge base (only the chunks relevant to this message when retrieval is enabled)
+	log.Printf("[BOT] Loading knowledge base...")
+	kb := KnowledgeContext(text)
+
 	log.Printf("[BOT] Querying AI for response...")
-	response := QueryKnowledgeBase(message.Text, kb, conv.ID)
+	var response *Reply
+	if b.Streaming {
+		// Show the reply while it is generated, editing one message in place
+		streamed := b.newStreamingReply(chatID)
+		response = QueryKnowledgeBaseStream(text, kb, conv.ID, streamed.Update)
+		checkHandoff(conv.ID, response)
+		log.Printf("[BOT] Finishing streamed response to user: %s", response.Text)
+		streamed.Finish(response.Text, replyKeyboard(response))
+	} else {
+		response = QueryKnowledgeBase(text, kb, conv.ID)
+		checkHandoff(conv.ID, response)
 
-	// Send response
-	log.Printf("[BOT] Sending response to user: %s", response)
-	b.sendMessage(message.Chat.ID, response)
+		// Send response
+		log.Printf("[BOT] Sending response to user: %s", response.Text)
+		b.sendReply(chatID, response.Text, replyKeyboard(response))
+	}
 
-	// Save bot response
-	err = database.SaveMessage(conv.ID, "bot", response)
+	// Save bot response (only the final text, not the partial edits) with its audit details
+	err := database.SaveMessageWithAudit(conv.ID, "bot", response.Text, response.Audit)
 	if err != nil {
 		log.Printf("[BOT] Error saving bot response: %v", err)
 	}
 
-	log.Printf("[BOT] Message handling completed for chat %d", message.Chat.ID)
+	// An order captured during this reply still needs the customer's confirmation
+	if response.Order != nil {
+		b.sendOrderConfirmation(chatID, conv.ID, response.Order)
+	}
+
+	if response.Handoff != "" {
+		b.handOff(conv, response.HandoffTrigger, response.Handoff)
+	}
+
+	log.Printf("[BOT] Message handling completed for chat %d", chatID)
+}
+
+// checkHandoff turns a reply into a handoff when the model asked for one or the AI
+// has failed too often in a row, replacing its text with the handoff message
+func checkHandoff(conversationID int, response *Reply) {
+	if handoff.recordResult(conversationID, response.Failed) {
+		response.Handoff = "AI gagal menjawab beberapa kali berturut-turut"
+		response.HandoffTrigger = HandoffErrors
+	} else if response.Handoff != "" {
+		response.HandoffTrigger = HandoffModel
+	}
+
+	if response.Handoff != "" {
+		response.Text = handoff.message
+	}
+}
+
+// replyKeyboard returns the quick-reply buttons to attach to an AI reply
+func replyKeyboard(response *Reply) *tgbotapi.InlineKeyboardMarkup {
+	if response.Greeting {
+		return quickReplyKeyboard(database.ShowOnStart)
+	}
+	return quickReplyKeyboard(database.ShowOnAlways)
 }
 
 func (b *Bot) sendMessage(chatID int64, text string) {
@@ -115,8 +330,20 @@ func (b *Bot) sendMessage(chatID int64, text string) {
 	}
 }
 
-// SendMessageAsAdmin sends a message from admin to user
-func (b *Bot) SendMessageAsAdmin(chatID int64, text string, conversationID int) error {
+// sendReply sends a message with optional inline buttons
+func (b *Bot) sendReply(chatID int64, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	_, err := b.API.Send(msg)
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+	}
+}
+
+// SendMessageAsAdmin sends a message from a dashboard user to the customer
+func (b *Bot) SendMessageAsAdmin(chatID int64, text string, conversationID int, sentBy string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
 	_, err := b.API.Send(msg)
 	if err != nil {
@@ -124,5 +351,5 @@ func (b *Bot) SendMessageAsAdmin(chatID int64, text string, conversationID int)
 	}
 
 	// Save admin message
-	return database.SaveMessage(conversationID, "admin", text)
+	return database.SaveAdminMessage(conversationID, sentBy, text)
 }
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"telecust/database"
+	"telecust/events"
+)
+
+// Handoff triggers, stored as the data of the handoff conversation event
+const (
+	HandoffKeyword = "keyword" // The customer asked for a human
+	HandoffModel   = "model"   // The model could not answer confidently
+	HandoffErrors  = "errors"  // The AI failed several times in a row
+	HandoffButton  = "button"  // The customer pressed a quick-reply handoff button
+)
+
+// defaultHandoffKeywords are phrases customers use to ask for a human
+var defaultHandoffKeywords = []string{
+	"bicara dengan admin",
+	"bicara sama admin",
+	"ngobrol dengan admin",
+	"ngobrol sama admin",
+	"hubungi admin",
+	"panggil admin",
+	"minta admin",
+	"sambungkan ke admin",
+	"bicara dengan manusia",
+	"bicara dengan orang",
+	"talk to a human",
+	"speak to a human",
+	"talk to an agent",
+}
+
+// handoffMarker starts a reply in which the model hands the conversation to an admin,
+// followed by the reason. Unlike the request_handoff tool it works with every provider.
+const handoffMarker = "[HANDOFF]"
+
+// defaultHandoffReason is used when the model hands off without saying why
+const defaultHandoffReason = "Model tidak yakin dengan jawabannya"
+
+const defaultHandoffMessage = "Baik kak, pertanyaan kakak kami teruskan ke admin ya. Admin kami akan segera membalas di chat ini, mohon ditunggu 🙏"
+
+// handoffPolicy decides when the bot hands a conversation to a human, configured with
+// HANDOFF_ENABLED, HANDOFF_KEYWORDS, HANDOFF_MAX_FAILURES and HANDOFF_MESSAGE
+type handoffPolicy struct {
+	enabled     bool
+	keywords    []string
+	maxFailures int // Consecutive failed AI replies before handing off, 0 = never
+	message     string
+
+	mu       sync.Mutex
+	failures map[int]int // Consecutive failed replies per conversation
+}
+
+// handoff is the active policy. It is disabled until InitBot reads the configuration.
+var handoff = &handoffPolicy{failures: map[int]int{}}
+
+func newHandoffPolicy() *handoffPolicy {
+	p := &handoffPolicy{
+		enabled:     os.Getenv("HANDOFF_ENABLED") != "false",
+		keywords:    defaultHandoffKeywords,
+		maxFailures: 2,
+		message:     defaultHandoffMessage,
+		failures:    map[int]int{},
+	}
+
+	if env := os.Getenv("HANDOFF_KEYWORDS"); env != "" {
+		p.keywords = nil
+		for _, keyword := range strings.Split(env, ",") {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+				p.keywords = append(p.keywords, keyword)
+			}
+		}
+	}
+	if env := os.Getenv("HANDOFF_MAX_FAILURES"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			p.maxFailures = n
+		}
+	}
+	if env := os.Getenv("HANDOFF_MESSAGE"); env != "" {
+		p.message = env
+	}
+	return p
+}
+
+// matchKeyword returns the handoff keyword found in a customer message, if any
+func (p *handoffPolicy) matchKeyword(text string) string {
+	if !p.enabled {
+		return ""
+	}
+	text = strings.ToLower(text)
+	for _, keyword := range p.keywords {
+		if strings.Contains(text, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// recordResult counts consecutive failed replies and reports whether the limit was reached
+func (p *handoffPolicy) recordResult(conversationID int, failed bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		delete(p.failures, conversationID)
+		return false
+	}
+
+	p.failures[conversationID]++
+	if !p.enabled || p.maxFailures == 0 || p.failures[conversationID] < p.maxFailures {
+		return false
+	}
+	delete(p.failures, conversationID)
+	return true
+}
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "request_handoff",
+		Description: "Serahkan percakapan ke admin manusia. Gunakan jika customer minta bicara dengan admin, jika jawabannya tidak ada di knowledge base, atau jika kamu tidak yakin jawabanmu benar. Customer akan diberitahu bahwa admin akan membalas.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"reason": map[string]interface{}{"type": "string", "description": "Alasan singkat untuk admin, misalnya pertanyaan yang tidak bisa dijawab"},
+			},
+			"required": []string{"reason"},
+		},
+		Handler: requestHandoff,
+	})
+}
+
+// requestHandoff marks the reply as a handoff; the handler pauses the bot once the reply is sent
+func requestHandoff(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	if !handoff.enabled {
+		return nil, fmt.Errorf("handoff to admin is disabled, answer the customer yourself")
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = defaultHandoffReason
+	}
+	if tc.Reply != nil {
+		tc.Reply.Handoff = reason
+	}
+
+	return map[string]string{"status": "Admin akan membalas customer. Jangan jawab pertanyaannya lagi."}, nil
+}
+
+// parseHandoffMarker splits a reply at the handoff marker into the text before it and
+// the reason after it. found is false when the reply has no marker.
+func parseHandoffMarker(text string) (before, reason string, found bool) {
+	before, reason, found = strings.Cut(text, handoffMarker)
+	if !found {
+		return text, "", false
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = defaultHandoffReason
+	}
+	return strings.TrimSpace(before), reason, true
+}
+
+// hideHandoffMarker returns the part of a partial reply that may be shown to the
+// customer: the text before the marker, without a marker that is still arriving
+func hideHandoffMarker(text string) string {
+	if before, _, found := strings.Cut(text, handoffMarker); found {
+		return before
+	}
+	for n := len(handoffMarker) - 1; n > 0; n-- {
+		if strings.HasSuffix(text, handoffMarker[:n]) {
+			return text[:len(text)-n]
+		}
+	}
+	return text
+}
+
+// handoffInstruction tells the model how to hand a conversation it cannot answer to an admin
+func handoffInstruction() string {
+	if !handoff.enabled {
+		return "Jika pertanyaan tidak bisa dijawab dari knowledge base, beritahu dengan sopan bahwa kamu tidak memiliki informasi tersebut"
+	}
+	return "Jika pertanyaan tidak bisa dijawab dari knowledge base atau kamu tidak yakin jawabanmu benar, jangan menjawabnya. Balas hanya dengan " +
+		handoffMarker + " diikuti alasan singkat untuk admin, misalnya: " + handoffMarker +
+		" Customer menanyakan garansi yang tidak ada di knowledge base. Admin yang akan membalas customer"
+}
+
+// handOff pauses the bot for a conversation and alerts agents. The customer has
+// already been told that a human will reply.
+func (b *Bot) handOff(conv *database.Conversation, trigger, reason string) {
+	log.Printf("[BOT] Handing conversation %d to a human (%s): %s", conv.ID, trigger, reason)
+
+	err := database.SetBotActive(conv.ID, false)
+	if err != nil {
+		log.Printf("[BOT] Error pausing bot for handoff: %v", err)
+		return
+	}
+	conv.IsBotActive = false
+
+	err = database.SaveConversationEvent(&database.ConversationEvent{
+		ConversationID: conv.ID,
+		Type:           database.EventHandoff,
+		Label:          reason,
+		Data:           trigger,
+	})
+	if err != nil {
+		log.Printf("[BOT] Error saving handoff event: %v", err)
+	}
+
+	events.Publish(events.Event{
+		Type:           events.HandoffRequested,
+		ConversationID: conv.ID,
+		Data:           map[string]string{"trigger": trigger, "reason": reason, "customer": customerName(conv)},
+	})
+
+	b.notifyStaff(conv, "Handoff requested", reason)
+}
+
+// sendHandoffMessage tells the customer a human will reply and stores the message
+func (b *Bot) sendHandoffMessage(chatID int64, conv *database.Conversation) {
+	b.sendMessage(chatID, handoff.message)
+	err := database.SaveMessage(conv.ID, "bot", handoff.message)
+	if err != nil {
+		log.Printf("[BOT] Error saving handoff message: %v", err)
+	}
+}
+
+// customerName returns the best available name for a conversation's customer
+func customerName(conv *database.Conversation) string {
+	username := ""
+	if conv.TelegramUsername != "" {
+		username = "@" + conv.TelegramUsername
+	}
+	return firstNonEmpty(conv.TelegramFirstName, username, strconv.FormatInt(conv.TelegramChatID, 10))
+}
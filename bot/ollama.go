@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type ollamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  map[string]int `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+// OllamaProvider talks to a local Ollama server through its native chat API
+type OllamaProvider struct {
+	APIBase        string
+	Model          string
+	EmbeddingModel string
+}
+
+// NewOllamaProvider creates an Ollama provider, filling in defaults for base URL and model
+func NewOllamaProvider(apiBase, model string) (*OllamaProvider, error) {
+	if apiBase == "" {
+		apiBase = "http://localhost:11434"
+	}
+	if model == "" {
+		model = "llama3.1"
+	}
+
+	embeddingModel := os.Getenv("OLLAMA_EMBEDDING_MODEL")
+	if embeddingModel == "" {
+		embeddingModel = "nomic-embed-text"
+	}
+
+	return &OllamaProvider{
+		APIBase:        strings.TrimSuffix(apiBase, "/"),
+		Model:          model,
+		EmbeddingModel: embeddingModel,
+	}, nil
+}
+
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (*Completion, error) {
+	model := p.Model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	log.Printf("[Ollama] Using model: %s", model)
+
+	requestBody := ollamaRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   false,
+	}
+	if opts.MaxTokens > 0 {
+		requestBody.Options = map[string]int{"num_predict": opts.MaxTokens}
+	}
+
+	var ollamaResp ollamaResponse
+	err := postJSON(ctx, "Ollama", p.APIBase+"/api/chat", nil, requestBody, &ollamaResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if ollamaResp.Message.Content == "" {
+		log.Printf("[Ollama] Empty message in response")
+		return nil, fmt.Errorf("no response from Ollama")
+	}
+
+	return &Completion{
+		Content: ollamaResp.Message.Content,
+		Model:   firstNonEmpty(ollamaResp.Model, model),
+		Usage: Usage{
+			PromptTokens:     ollamaResp.PromptEvalCount,
+			CompletionTokens: ollamaResp.EvalCount,
+			TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
+		},
+	}, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func (p *OllamaProvider) EmbeddingModelName() string {
+	return "ollama/" + p.EmbeddingModel
+}
+
+// Embed calls the native embed endpoint for a batch of texts
+func (p *OllamaProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	log.Printf("[Ollama] Embedding %d texts with model: %s", len(texts), p.EmbeddingModel)
+
+	var embedResp ollamaEmbedResponse
+	err := postJSON(ctx, "Ollama", p.APIBase+"/api/embed", nil, ollamaEmbedRequest{Model: p.EmbeddingModel, Input: texts}, &embedResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings from Ollama, got %d", len(texts), len(embedResp.Embeddings))
+	}
+	return embedResp.Embeddings, nil
+}
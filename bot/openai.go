@@ -0,0 +1,302 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type OpenAIRequest struct {
+	Model     string           `json:"model"`
+	Messages  []Message        `json:"messages"`
+	MaxTokens int              `json:"max_tokens,omitempty"`
+	Tools     []ToolDefinition `json:"tools,omitempty"`
+}
+
+type OpenAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *openAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// OpenAIProvider talks to the OpenAI chat completions API or any compatible service
+type OpenAIProvider struct {
+	APIBase        string
+	APIKey         string
+	Model          string
+	EmbeddingModel string
+}
+
+// NewOpenAIProvider creates an OpenAI provider, filling in defaults for base URL and model
+func NewOpenAIProvider(apiBase, apiKey, model string) (*OpenAIProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not set")
+	}
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "gpt-3.5-turbo"
+	}
+
+	embeddingModel := os.Getenv("OPENAI_EMBEDDING_MODEL")
+	if embeddingModel == "" {
+		embeddingModel = "text-embedding-3-small"
+	}
+
+	return &OpenAIProvider{
+		APIBase:        strings.TrimSuffix(apiBase, "/"),
+		APIKey:         apiKey,
+		Model:          model,
+		EmbeddingModel: embeddingModel,
+	}, nil
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (*Completion, error) {
+	model := p.Model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	log.Printf("[OpenAI] Using model: %s, API key: %s", model, maskKey(p.APIKey))
+
+	requestBody := OpenAIRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: opts.MaxTokens,
+		Tools:     opts.Tools,
+	}
+
+	var openAIResp OpenAIResponse
+	err := postJSON(ctx, "OpenAI", p.APIBase+"/chat/completions", map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", p.APIKey),
+	}, requestBody, &openAIResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		log.Printf("[OpenAI] No choices in response")
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	log.Printf("[OpenAI] Successfully parsed response, choices: %d", len(openAIResp.Choices))
+	return &Completion{
+		Content:   openAIResp.Choices[0].Message.Content,
+		Model:     firstNonEmpty(openAIResp.Model, model),
+		Usage:     openAIResp.Usage.toUsage(),
+		ToolCalls: openAIResp.Choices[0].Message.ToolCalls,
+	}, nil
+}
+
+type openAIStreamRequest struct {
+	OpenAIRequest
+	Stream        bool `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type openAIStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int              `json:"index"`
+				ID       string           `json:"id"`
+				Type     string           `json:"type"`
+				Function ToolCallFunction `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// Stream uses the server-sent events mode of the chat completions API
+func (p *OpenAIProvider) Stream(ctx context.Context, messages []Message, opts CompletionOptions, onDelta func(delta string)) (*Completion, error) {
+	model := p.Model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	log.Printf("[OpenAI] Streaming with model: %s, API key: %s", model, maskKey(p.APIKey))
+
+	requestBody := openAIStreamRequest{
+		OpenAIRequest: OpenAIRequest{
+			Model:     model,
+			Messages:  messages,
+			MaxTokens: opts.MaxTokens,
+			Tools:     opts.Tools,
+		},
+		Stream: true,
+	}
+	// Ask for a final chunk with token usage
+	requestBody.StreamOptions.IncludeUsage = true
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		log.Printf("[OpenAI] Failed to marshal request: %v", err)
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.APIBase+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("[OpenAI] Failed to create request: %v", err)
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[OpenAI] HTTP request failed: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	log.Printf("[OpenAI] Stream response status: %d %s", resp.StatusCode, resp.Status)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("[OpenAI] API returned error: %s", string(body))
+		return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	completion := &Completion{Model: model}
+	var content strings.Builder
+	// Tool calls arrive in fragments keyed by index; the arguments string is split across chunks
+	var toolCalls []ToolCall
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			// Blank separators, comments and event names carry no content
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Printf("[OpenAI] Skipping malformed stream chunk: %v", err)
+			continue
+		}
+
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			for _, fragment := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= fragment.Index {
+					toolCalls = append(toolCalls, ToolCall{Type: "function"})
+				}
+				call := &toolCalls[fragment.Index]
+				if fragment.ID != "" {
+					call.ID = fragment.ID
+				}
+				call.Function.Name += fragment.Function.Name
+				call.Function.Arguments += fragment.Function.Arguments
+			}
+
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("[OpenAI] Failed to read stream: %v", err)
+		return nil, err
+	}
+
+	if content.Len() == 0 && len(toolCalls) == 0 {
+		log.Printf("[OpenAI] Stream finished without content")
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	completion.Content = content.String()
+	completion.ToolCalls = toolCalls
+	log.Printf("[OpenAI] Stream finished (%d chars, %d tool calls)", content.Len(), len(toolCalls))
+	return completion, nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (p *OpenAIProvider) EmbeddingModelName() string {
+	return "openai/" + p.EmbeddingModel
+}
+
+// Embed calls the embeddings endpoint for a batch of texts
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	log.Printf("[OpenAI] Embedding %d texts with model: %s", len(texts), p.EmbeddingModel)
+
+	var embeddingResp openAIEmbeddingResponse
+	err := postJSON(ctx, "OpenAI", p.APIBase+"/embeddings", map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", p.APIKey),
+	}, openAIEmbeddingRequest{Model: p.EmbeddingModel, Input: texts}, &embeddingResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings from OpenAI, got %d", len(texts), len(embeddingResp.Data))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, item := range embeddingResp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
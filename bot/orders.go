@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telecust/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "create_order",
+		Description: "Catat pesanan customer setelah produk dan jumlahnya jelas. Harga dihitung otomatis dari katalog dan customer akan diminta konfirmasi lewat tombol, jadi jangan anggap pesanan sudah final.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"product":  map[string]interface{}{"type": "string", "description": "Nama produk, boleh kosong jika hanya ada satu produk"},
+							"quantity": map[string]interface{}{"type": "integer"},
+						},
+						"required": []string{"quantity"},
+					},
+				},
+				"notes": map[string]interface{}{"type": "string", "description": "Catatan pesanan seperti alamat atau waktu pengambilan"},
+			},
+			"required": []string{"items"},
+		},
+		Handler: createOrder,
+	})
+
+	RegisterTool(Tool{
+		Name:        "order_status",
+		Description: "Lihat pesanan customer ini beserta statusnya (pending = menunggu konfirmasi, confirmed, completed, cancelled).",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		Handler: orderStatus,
+	})
+
+	RegisterCallback(orderCallbackPrefix, handleOrderCallback)
+}
+
+// createOrder prices the requested items from the catalog and stores a pending order.
+// The order is attached to the reply so the handler can ask the customer to confirm it.
+func createOrder(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	var req struct {
+		Items []struct {
+			Product  string `json:"product"`
+			Quantity int    `json:"quantity"`
+		} `json:"items"`
+		Notes string `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("order has no items")
+	}
+	if len(req.Items) > database.MaxOrderItems {
+		return nil, fmt.Errorf("an order can have at most %d items", database.MaxOrderItems)
+	}
+
+	products, err := database.ListEnabledProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	order := &database.Order{
+		ConversationID: tc.ConversationID,
+		Notes:          strings.TrimSpace(req.Notes),
+	}
+	for _, requested := range req.Items {
+		product, err := findProduct(products, requested.Product)
+		if err != nil {
+			return nil, err
+		}
+
+		quote, err := product.Quote(requested.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, database.OrderItem{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			Quantity:    quote.Quantity,
+			Unit:        quote.Unit,
+			UnitPrice:   quote.UnitPrice,
+			Total:       quote.Total,
+		})
+	}
+
+	err = database.CreateOrder(order)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ORDERS] Created pending order #%d for conversation %d (total %s)",
+		order.ID, order.ConversationID, formatRupiah(order.Total))
+
+	if tc.Reply != nil {
+		tc.Reply.Order = order
+	}
+
+	return map[string]interface{}{
+		"order":   order,
+		"summary": formatOrder(order),
+		"next":    "Customer akan menerima ringkasan pesanan dengan tombol konfirmasi. Sampaikan totalnya dan minta customer menekan tombol Konfirmasi.",
+	}, nil
+}
+
+// orderStatus lists the orders of the current conversation
+func orderStatus(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	orders, err := database.ListOrders("", tc.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []map[string]interface{}
+	for i := range orders {
+		summaries = append(summaries, map[string]interface{}{
+			"id":      orders[i].ID,
+			"status":  orders[i].Status,
+			"summary": formatOrder(&orders[i]),
+		})
+	}
+	if len(summaries) == 0 {
+		return map[string]string{"message": "Customer belum punya pesanan"}, nil
+	}
+	return summaries, nil
+}
+
+func productNames(products []database.Product) string {
+	var names []string
+	for _, p := range products {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatOrder renders an order as a short multi-line summary for customers
+func formatOrder(o *database.Order) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pesanan #%d\n", o.ID)
+	for _, item := range o.Items {
+		fmt.Fprintf(&b, "- %d %s %s x %s = %s\n",
+			item.Quantity, item.Unit, item.ProductName, formatRupiah(item.UnitPrice), formatRupiah(item.Total))
+	}
+	if o.Notes != "" {
+		fmt.Fprintf(&b, "Catatan: %s\n", o.Notes)
+	}
+	fmt.Fprintf(&b, "Total: %s", formatRupiah(o.Total))
+	return b.String()
+}
+
+// orderCallbackPrefix is the callback prefix of the order confirmation buttons,
+// e.g. "order:confirm:12" and "order:cancel:12"
+const orderCallbackPrefix = "order"
+
+// sendOrderConfirmation shows a pending order to the customer with buttons to confirm or cancel it
+func (b *Bot) sendOrderConfirmation(chatID int64, conversationID int, order *database.Order) {
+	text := formatOrder(order) + "\n\nMohon konfirmasi pesanan di atas ya, kak."
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Konfirmasi", callbackData(orderCallbackPrefix, "confirm:"+strconv.Itoa(order.ID))),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", callbackData(orderCallbackPrefix, "cancel:"+strconv.Itoa(order.ID))),
+		),
+	)
+
+	_, err := b.API.Send(msg)
+	if err != nil {
+		log.Printf("[ORDERS] Error sending confirmation for order #%d: %v", order.ID, err)
+		return
+	}
+
+	err = database.SaveMessage(conversationID, "bot", text)
+	if err != nil {
+		log.Printf("[ORDERS] Error saving confirmation message: %v", err)
+	}
+}
+
+// handleOrderCallback confirms or cancels an order from its confirmation buttons
+func handleOrderCallback(b *Bot, query *tgbotapi.CallbackQuery, conv *database.Conversation, arg string) {
+	action, idText, _ := strings.Cut(arg, ":")
+
+	var status string
+	switch action {
+	case "confirm":
+		status = database.OrderConfirmed
+	case "cancel":
+		status = database.OrderCancelled
+	default:
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	orderID, err := strconv.Atoi(idText)
+	if err != nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	b.updateOrderFromCallback(query, conv, orderID, status)
+}
+
+// updateOrderFromCallback confirms or cancels a pending order after the customer pressed a button
+func (b *Bot) updateOrderFromCallback(query *tgbotapi.CallbackQuery, conv *database.Conversation, orderID int, status string) {
+	chatID := query.Message.Chat.ID
+
+	order, err := database.GetOrder(orderID)
+	if err != nil {
+		log.Printf("[ORDERS] Error loading order #%d: %v", orderID, err)
+		b.answerCallback(query.ID, "Terjadi kesalahan, coba lagi nanti")
+		return
+	}
+	if order == nil || order.ConversationID != conv.ID {
+		b.answerCallback(query.ID, "Pesanan tidak ditemukan")
+		return
+	}
+	if order.Status != database.OrderPending {
+		b.answerCallback(query.ID, "Pesanan ini sudah diproses")
+		return
+	}
+
+	err = database.SetOrderStatus(order.ID, status)
+	if err != nil {
+		log.Printf("[ORDERS] Error updating order #%d: %v", order.ID, err)
+		b.answerCallback(query.ID, "Terjadi kesalahan, coba lagi nanti")
+		return
+	}
+	log.Printf("[ORDERS] Order #%d %s by customer", order.ID, status)
+
+	var reply string
+	if status == database.OrderConfirmed {
+		b.answerCallback(query.ID, "Pesanan dikonfirmasi")
+		reply = fmt.Sprintf("Terima kasih, kak! Pesanan #%d sudah kami terima dan akan segera diproses.", order.ID)
+	} else {
+		b.answerCallback(query.ID, "Pesanan dibatalkan")
+		reply = fmt.Sprintf("Pesanan #%d sudah dibatalkan, kak. Silakan kabari jika ingin memesan lagi.", order.ID)
+	}
+
+	// Replace the buttons with the outcome so they cannot be pressed again
+	edit := tgbotapi.NewEditMessageText(chatID, query.Message.MessageID,
+		formatOrder(order)+"\n\nStatus: "+status)
+	if _, err := b.API.Send(edit); err != nil {
+		log.Printf("[ORDERS] Error editing confirmation message: %v", err)
+	}
+
+	b.sendMessage(chatID, reply)
+	err = database.SaveMessage(conv.ID, "bot", reply)
+	if err != nil {
+		log.Printf("[ORDERS] Error saving message: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"telecust/database"
+	"testing"
+)
+
+func TestCreateOrderBounds(t *testing.T) {
+	tooMany := `{"items":[` + strings.Repeat(`{"quantity":1},`, database.MaxOrderItems) + `{"quantity":1}]}`
+
+	tests := []struct {
+		name    string
+		args    string
+		wantErr string
+	}{
+		{"valid", `{"items":[{"quantity":20}]}`, ""},
+		{"no items", `{"items":[]}`, "no items"},
+		{"too many items", tooMany, "at most"},
+		{"negative quantity", `{"items":[{"quantity":-5}]}`, "between 1 and"},
+		{"quantity too large", `{"items":[{"quantity":1000001}]}`, "between 1 and"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			conv := newTestConversation(t, int64(7000+i))
+
+			result, err := createOrder(context.Background(), ToolContext{ConversationID: conv.ID}, json.RawMessage(tt.args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("createOrder: %v", err)
+			}
+			if order := result.(map[string]interface{})["order"].(*database.Order); order.Total <= 0 {
+				t.Errorf("total = %d, want a positive total", order.Total)
+			}
+		})
+	}
+}
+
+func TestCreateOrderRejectsOverflow(t *testing.T) {
+	useTestDB(t)
+	conv := newTestConversation(t, 7100)
+
+	tests := []struct {
+		name  string
+		items []database.OrderItem
+	}{
+		{"non-positive total", []database.OrderItem{{ProductName: "Kopi", Quantity: 1, UnitPrice: 0, Total: 0}}},
+		{"sum overflows", []database.OrderItem{
+			{ProductName: "Kopi", Quantity: 1, UnitPrice: math.MaxInt64, Total: math.MaxInt64},
+			{ProductName: "Teh", Quantity: 1, UnitPrice: 1, Total: 1},
+		}},
+		{"quantity too large", []database.OrderItem{{ProductName: "Kopi", Quantity: database.MaxQuantity + 1, UnitPrice: 1, Total: database.MaxQuantity + 1}}},
+	}
+
+	for _, tt := range tests {
+		if err := database.CreateOrder(&database.Order{ConversationID: conv.ID, Items: tt.items}); err == nil {
+			t.Errorf("%s: CreateOrder succeeded, want an error", tt.name)
+		}
+	}
+}
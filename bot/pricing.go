@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"telecust/database"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "calculate_price",
+		Description: "Hitung harga pesanan dari katalog produk berdasarkan jumlah (harga bertingkat sudah diperhitungkan). Wajib dipakai setiap kali customer menyebut jumlah.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"product":  map[string]interface{}{"type": "string", "description": "Nama produk, boleh kosong jika hanya ada satu produk"},
+				"quantity": map[string]interface{}{"type": "integer", "description": "Jumlah yang dipesan"},
+			},
+			"required": []string{"quantity"},
+		},
+		Handler: calculatePrice,
+	})
+}
+
+// calculatePrice quotes a product from the catalog using its price tiers
+func calculatePrice(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+	var req struct {
+		Product  string `json:"product"`
+		Quantity int    `json:"quantity"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+	products, err := database.ListEnabledProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := findProduct(products, req.Product)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := product.Quote(req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"quote":     quote,
+		"formatted": formatQuote(quote),
+	}, nil
+}
+
+// minPartialMatch is the shortest name that may match part of a product name or alias
+const minPartialMatch = 3
+
+// findProduct matches a product by exact name or alias, falling back to names that
+// contain one another. It fails when no product or more than one product matches, so
+// an ambiguous name is never quoted or ordered as the wrong product. An empty name
+// matches when the catalog has a single product.
+func findProduct(products []database.Product, name string) (*database.Product, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		if len(products) == 1 {
+			return &products[0], nil
+		}
+		return nil, fmt.Errorf("several products are available, name one of: %s", productNames(products))
+	}
+
+	exact := matchProducts(products, func(candidate string) bool { return candidate == name })
+	if len(exact) == 0 && len([]rune(name)) >= minPartialMatch {
+		exact = matchProducts(products, func(candidate string) bool {
+			return strings.Contains(name, candidate) || strings.Contains(candidate, name)
+		})
+	}
+
+	switch len(exact) {
+	case 0:
+		return nil, fmt.Errorf("product %q not found, available: %s", name, productNames(products))
+	case 1:
+		return exact[0], nil
+	default:
+		var names []string
+		for _, p := range exact {
+			names = append(names, p.Name)
+		}
+		return nil, fmt.Errorf("product %q is ambiguous, it matches: %s. Ask the customer which one they mean", name, strings.Join(names, ", "))
+	}
+}
+
+// matchProducts returns the products with a name or alias accepted by match
+func matchProducts(products []database.Product, match func(candidate string) bool) []*database.Product {
+	var matched []*database.Product
+	for i := range products {
+		for _, candidate := range products[i].Names() {
+			if match(candidate) {
+				matched = append(matched, &products[i])
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// quantityPattern finds numbers with what may mark them as prices: a leading "Rp" or a
+// trailing "rb", "k", "%" and the like
+var quantityPattern = regexp.MustCompile(`(?i)(rp\.?\s*)?\b(\d{1,6})\b\s*(rb|ribu|k|jt|juta|%)?`)
+
+// thousandsBefore and thousandsAfter spot digit groups of a number written with
+// thousands separators, such as the "500" and the "12" of "Rp12.500"
+var (
+	thousandsBefore = regexp.MustCompile(`\d[.,]$`)
+	thousandsAfter  = regexp.MustCompile(`^[.,]\d{3}`)
+)
+
+// quotedQuantity is a quantity of a product the customer asked about
+type quotedQuantity struct {
+	product  *database.Product
+	quantity int
+}
+
+// priceHints computes catalog quotes for quantities mentioned in a customer message,
+// so the AI can quote totals that are arithmetically correct. Only numbers written
+// next to a product name or unit count, e.g. "20 bungkus" or "kentang 20", so prices,
+// dates, times and phone numbers are not mistaken for quantities.
+func priceHints(userQuery string) string {
+	products, err := database.ListEnabledProducts()
+	if err != nil {
+		log.Printf("[PRICING] Error loading products: %v", err)
+		return ""
+	}
+	if len(products) == 0 {
+		return ""
+	}
+
+	quantities := findQuantities(strings.ToLower(userQuery), products)
+	if len(quantities) == 0 {
+		return ""
+	}
+
+	var lines []string
+	for _, q := range quantities {
+		if quote, err := q.product.Quote(q.quantity); err == nil {
+			lines = append(lines, "- "+formatQuote(quote))
+		}
+	}
+
+	log.Printf("[PRICING] Computed %d price hints", len(lines))
+	return strings.Join(lines, "\n")
+}
+
+// findQuantities returns the product quantities in a lowercased message. A number next
+// to a product's name is a quantity of that product; a number next to a unit is one of
+// every product with that unit, narrowed to the products the message names.
+func findQuantities(text string, products []database.Product) []quotedQuantity {
+	mentioned := map[int]bool{}
+	for i := range products {
+		for _, name := range products[i].Names() {
+			if containsWord(text, name) {
+				mentioned[products[i].ID] = true
+			}
+		}
+	}
+
+	var quantities []quotedQuantity
+	seen := map[quotedQuantity]bool{}
+	for _, match := range quantityPattern.FindAllStringSubmatchIndex(text, -1) {
+		if match[2] >= 0 || match[6] >= 0 {
+			continue // a price or percentage, not a quantity
+		}
+		start, end := match[4], match[5]
+		if thousandsBefore.MatchString(text[:start]) || thousandsAfter.MatchString(text[end:]) {
+			continue // part of a number such as 12.500
+		}
+		qty, err := strconv.Atoi(text[start:end])
+		if err != nil || qty <= 0 {
+			continue
+		}
+
+		before := strings.TrimRight(text[:start], " ")
+		after := strings.TrimLeft(text[end:], " ")
+		for i := range products {
+			p := &products[i]
+			nextToName, nextToUnit := false, false
+			for _, name := range p.Names() {
+				if hasWordPrefix(after, name) || hasWordSuffix(before, name) {
+					nextToName = true
+				}
+			}
+			if unit := strings.ToLower(strings.TrimSpace(p.Unit)); unit != "" && hasWordPrefix(after, unit) {
+				nextToUnit = len(mentioned) == 0 || mentioned[p.ID]
+			}
+
+			q := quotedQuantity{product: p, quantity: qty}
+			if (nextToName || nextToUnit) && !seen[q] {
+				seen[q] = true
+				quantities = append(quantities, q)
+			}
+		}
+	}
+	return quantities
+}
+
+// hasWordPrefix reports whether text starts with word followed by a non-letter
+func hasWordPrefix(text, word string) bool {
+	return word != "" && strings.HasPrefix(text, word) && !startsWithLetter(text[len(word):])
+}
+
+// hasWordSuffix reports whether text ends with word preceded by a non-letter
+func hasWordSuffix(text, word string) bool {
+	return word != "" && strings.HasSuffix(text, word) && !endsWithLetter(text[:len(text)-len(word)])
+}
+
+// containsWord reports whether word appears in text as a whole word
+func containsWord(text, word string) bool {
+	for i := strings.Index(text, word); word != "" && i >= 0; {
+		if !endsWithLetter(text[:i]) && !startsWithLetter(text[i+len(word):]) {
+			return true
+		}
+		next := strings.Index(text[i+1:], word)
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	return false
+}
+
+func startsWithLetter(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsLetter(r)
+}
+
+func endsWithLetter(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return unicode.IsLetter(r)
+}
+
+func formatQuote(q database.PriceQuote) string {
+	return fmt.Sprintf("%d %s %s: %s/%s, total %s",
+		q.Quantity, q.Unit, q.ProductName, formatRupiah(q.UnitPrice), q.Unit, formatRupiah(q.Total))
+}
+
+// formatRupiah formats an amount like Rp80.000
+func formatRupiah(amount int64) string {
+	digits := strconv.FormatInt(amount, 10)
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+
+	if negative {
+		return "-Rp" + b.String()
+	}
+	return "Rp" + b.String()
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"telecust/database"
+	"testing"
+)
+
+func TestFindProduct(t *testing.T) {
+	products := []database.Product{
+		{ID: 1, Name: "Kopi Arabica", Aliases: "arabica, kopi"},
+		{ID: 2, Name: "Kopi Robusta", Aliases: "robusta"},
+		{ID: 3, Name: "Teh Hijau", Aliases: "teh"},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantID  int
+		wantErr string
+	}{
+		{"exact name", "Kopi Robusta", 2, ""},
+		{"exact alias wins over partial matches", "kopi", 1, ""},
+		{"alias case and spaces", "  TEH ", 3, ""},
+		{"partial match", "robusta 1kg", 2, ""},
+		{"ambiguous partial match", "kop", 0, "ambiguous"},
+		{"too short for a partial match", "te", 0, "not found"},
+		{"unknown", "susu", 0, "not found"},
+		{"empty with several products", "", 0, "name one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, err := findProduct(products, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findProduct: %v", err)
+			}
+			if product.ID != tt.wantID {
+				t.Errorf("product = %d, want %d", product.ID, tt.wantID)
+			}
+		})
+	}
+
+	t.Run("empty with a single product", func(t *testing.T) {
+		product, err := findProduct(products[:1], "")
+		if err != nil || product.ID != 1 {
+			t.Fatalf("findProduct = %v, %v, want product 1", product, err)
+		}
+	})
+}
+
+func TestCalculatePriceBounds(t *testing.T) {
+	useTestDB(t)
+
+	tests := []struct {
+		name    string
+		args    string
+		wantErr string
+	}{
+		{"zero", `{"quantity":0}`, "between 1 and"},
+		{"largest allowed", `{"quantity":1000000}`, ""},
+		{"too large", `{"quantity":1000001}`, "between 1 and"},
+		{"would overflow", `{"quantity":9223372036854775807}`, "between 1 and"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculatePrice(context.Background(), ToolContext{}, json.RawMessage(tt.args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("calculatePrice: %v", err)
+			}
+			if quote := result.(map[string]interface{})["quote"].(database.PriceQuote); quote.Total <= 0 {
+				t.Errorf("total = %d, want a positive total", quote.Total)
+			}
+		})
+	}
+}
+
+func TestProductValidatePriceBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		product database.Product
+		wantErr bool
+	}{
+		{"valid", database.Product{Name: "Kopi", BasePrice: 5000, Tiers: []database.PriceTier{{MinQuantity: 10, UnitPrice: 4000}}}, false},
+		{"base price too large", database.Product{Name: "Kopi", BasePrice: database.MaxUnitPrice + 1}, true},
+		{"tier price too large", database.Product{Name: "Kopi", BasePrice: 5000, Tiers: []database.PriceTier{{MinQuantity: 10, UnitPrice: database.MaxUnitPrice + 1}}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.product.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFindQuantities(t *testing.T) {
+	products := []database.Product{
+		{ID: 1, Name: "Keripik kentang", Aliases: "kentang, keripik", Unit: "bungkus"},
+		{ID: 2, Name: "Kopi", Unit: "bungkus"},
+		{ID: 3, Name: "Teh", Unit: "botol"},
+	}
+
+	tests := []struct {
+		text string
+		want []string // "productID:quantity"
+	}{
+		{"mau 20 bungkus kentang", []string{"1:20"}},
+		{"kentang 20 ya", []string{"1:20"}},
+		{"pesan 5 botol", []string{"3:5"}},
+		{"20 bungkus", []string{"1:20", "2:20"}},
+		{"harganya rp12.500 per bungkus", nil},
+		{"total 12.500 bungkus", nil},
+		{"1,000 bungkus kentang", nil},
+		{"kirim tanggal 12/10 jam 10:30", nil},
+		{"hubungi 0812 3456 7890", nil},
+		{"diskon 10% kentang", nil},
+		{"kentang 4rb", nil},
+		{"pesan 20", nil},
+		{"20 bungkusan", nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, q := range findQuantities(tt.text, products) {
+			got = append(got, fmt.Sprintf("%d:%d", q.product.ID, q.quantity))
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("findQuantities(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
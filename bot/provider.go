@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Provider is an LLM backend that can answer a chat conversation.
+// QueryKnowledgeBase only talks to this interface, so the vendor can be
+// switched per deployment with AI_PROVIDER and tests can plug in a fake.
+type Provider interface {
+	// Name returns a short identifier used in logs (e.g. "openai").
+	Name() string
+	// Complete sends the messages (system prompt first) and returns the reply.
+	Complete(ctx context.Context, messages []Message, opts CompletionOptions) (*Completion, error)
+}
+
+// StreamingProvider is implemented by providers that can stream a reply
+// while it is being generated
+type StreamingProvider interface {
+	Provider
+	// Stream works like Complete but calls onDelta with every chunk of text as it arrives
+	Stream(ctx context.Context, messages []Message, opts CompletionOptions, onDelta func(delta string)) (*Completion, error)
+}
+
+// Embedder is implemented by providers that can turn text into embedding vectors
+type Embedder interface {
+	// EmbeddingModelName identifies the vector space, so stored embeddings can be invalidated
+	EmbeddingModelName() string
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// CompletionOptions tweaks a single completion request
+type CompletionOptions struct {
+	Model     string           // Overrides the provider's default model when set
+	MaxTokens int              // 0 means provider default
+	Tools     []ToolDefinition // Tools the model may call; providers without tool support ignore them
+}
+
+// Completion is the result of a completion request
+type Completion struct {
+	Content   string
+	Model     string
+	Usage     Usage
+	ToolCalls []ToolCall // Tools the model wants to run before it can answer
+}
+
+// ToolDefinition describes a callable tool in the OpenAI "tools" format
+type ToolDefinition struct {
+	Type     string       `json:"type"` // always "function"
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the name, description and JSON schema of a tool
+type ToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a request from the model to run a tool
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction holds the tool name and its JSON-encoded arguments
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Usage is the token usage reported by the provider (zero when not reported)
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Add accumulates usage over several requests
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// activeProvider is the provider used by QueryKnowledgeBase
+var activeProvider Provider
+
+// SetProvider replaces the provider used by the bot (useful for tests)
+func SetProvider(p Provider) {
+	activeProvider = p
+}
+
+// CurrentProvider returns the configured provider, or nil if none is set
+func CurrentProvider() Provider {
+	return activeProvider
+}
+
+// InitProvider creates the provider selected by AI_PROVIDER (openai, anthropic
+// or ollama, default openai) and makes it the active one
+func InitProvider() error {
+	p, err := NewProviderFromEnv()
+	if err != nil {
+		return err
+	}
+
+	SetProvider(p)
+	log.Printf("AI provider configured: %s", p.Name())
+	return nil
+}
+
+// NewProviderFromEnv builds a provider from environment variables
+func NewProviderFromEnv() (Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("AI_PROVIDER")))
+
+	switch name {
+	case "", "openai":
+		return NewOpenAIProvider(os.Getenv("OPENAI_API_BASE"), os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_MODEL"))
+	case "anthropic":
+		return NewAnthropicProvider(os.Getenv("ANTHROPIC_API_BASE"), os.Getenv("ANTHROPIC_API_KEY"), os.Getenv("ANTHROPIC_MODEL"))
+	case "ollama":
+		return NewOllamaProvider(os.Getenv("OLLAMA_API_BASE"), os.Getenv("OLLAMA_MODEL"))
+	default:
+		return nil, fmt.Errorf("unknown AI_PROVIDER %q (expected openai, anthropic or ollama)", name)
+	}
+}
+
+// NewEmbedderFromEnv builds the embedder used for knowledge base retrieval.
+// EMBEDDING_PROVIDER selects openai or ollama; when unset the active chat
+// provider is used if it supports embeddings. Returns nil if none is available.
+func NewEmbedderFromEnv() (Embedder, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("EMBEDDING_PROVIDER")))
+
+	switch name {
+	case "":
+		if e, ok := activeProvider.(Embedder); ok {
+			return e, nil
+		}
+		return nil, nil
+	case "openai":
+		return NewOpenAIProvider(os.Getenv("OPENAI_API_BASE"), os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_MODEL"))
+	case "ollama":
+		return NewOllamaProvider(os.Getenv("OLLAMA_API_BASE"), os.Getenv("OLLAMA_MODEL"))
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q (expected openai or ollama)", name)
+	}
+}
+
+// postJSON sends body as JSON to url and decodes a 200 response into out
+func postJSON(ctx context.Context, tag, url string, headers map[string]string, body, out interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("[%s] Failed to marshal request: %v", tag, err)
+		return err
+	}
+
+	log.Printf("[%s] POST %s (%d bytes)", tag, url, len(jsonData))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("[%s] Failed to create request: %v", tag, err)
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[%s] HTTP request failed: %v", tag, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	log.Printf("[%s] Response status: %d %s", tag, resp.StatusCode, resp.Status)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("[%s] Failed to read response body: %v", tag, err)
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("[%s] API returned error: %s", tag, string(respBody))
+		return fmt.Errorf("%s API error (status %d): %s", tag, resp.StatusCode, string(respBody))
+	}
+
+	err = json.Unmarshal(respBody, out)
+	if err != nil {
+		log.Printf("[%s] Failed to parse response JSON: %v", tag, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewProviderFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantName string
+		wantErr  string
+	}{
+		{
+			name:     "openai by default",
+			env:      map[string]string{"OPENAI_API_KEY": "sk-test"},
+			wantName: "openai",
+		},
+		{
+			name:     "openai explicitly, case and space insensitive",
+			env:      map[string]string{"AI_PROVIDER": " OpenAI ", "OPENAI_API_KEY": "sk-test"},
+			wantName: "openai",
+		},
+		{
+			name:    "openai without key",
+			env:     map[string]string{"AI_PROVIDER": "openai"},
+			wantErr: "OPENAI_API_KEY not set",
+		},
+		{
+			name:     "anthropic",
+			env:      map[string]string{"AI_PROVIDER": "anthropic", "ANTHROPIC_API_KEY": "key"},
+			wantName: "anthropic",
+		},
+		{
+			name:    "anthropic without key",
+			env:     map[string]string{"AI_PROVIDER": "anthropic"},
+			wantErr: "ANTHROPIC_API_KEY not set",
+		},
+		{
+			name:     "ollama needs no key",
+			env:      map[string]string{"AI_PROVIDER": "ollama"},
+			wantName: "ollama",
+		},
+		{
+			name:    "unknown provider",
+			env:     map[string]string{"AI_PROVIDER": "gemini"},
+			wantErr: `unknown AI_PROVIDER "gemini"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"AI_PROVIDER", "OPENAI_API_KEY", "OPENAI_API_BASE", "OPENAI_MODEL",
+				"ANTHROPIC_API_KEY", "ANTHROPIC_API_BASE", "ANTHROPIC_MODEL", "OLLAMA_API_BASE", "OLLAMA_MODEL"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			provider, err := NewProviderFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProviderFromEnv: %v", err)
+			}
+			if provider.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", provider.Name(), tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"telecust/database"
+	"time"
+)
+
+// Retrieval settings, configured by InitRetrieval
+var (
+	embedder       Embedder
+	retrievalTopK  = 4
+	chunkSize      = 500
+	reindexMu      sync.Mutex
+	reindexTimeout = 5 * time.Minute
+)
+
+// InitRetrieval configures the embedder used for knowledge base retrieval and
+// builds the chunk index in the background. Without an embedder (or with
+// RAG_ENABLED=false) the bot falls back to sending the whole knowledge base.
+func InitRetrieval() error {
+	if os.Getenv("RAG_ENABLED") == "false" {
+		log.Println("Knowledge base retrieval disabled (RAG_ENABLED=false)")
+		return nil
+	}
+
+	if envTopK := os.Getenv("RAG_TOP_K"); envTopK != "" {
+		if k, err := strconv.Atoi(envTopK); err == nil && k > 0 {
+			retrievalTopK = k
+		}
+	}
+	if envSize := os.Getenv("RAG_CHUNK_SIZE"); envSize != "" {
+		if size, err := strconv.Atoi(envSize); err == nil && size > 0 {
+			chunkSize = size
+		}
+	}
+
+	e, err := NewEmbedderFromEnv()
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		log.Println("No embedding provider available, knowledge base retrieval disabled")
+		return nil
+	}
+
+	embedder = e
+	log.Printf("Knowledge base retrieval enabled (model: %s, top-k: %d, chunk size: %d)",
+		embedder.EmbeddingModelName(), retrievalTopK, chunkSize)
+
+	go func() {
+		if err := ReindexKnowledgeBase(); err != nil {
+			log.Printf("[RAG] Initial indexing failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ReindexKnowledgeBase splits every enabled knowledge base document into chunks and stores their
+// embeddings. Chunks whose text did not change keep their existing embedding. When embedding
+// the new text fails, outdated chunks are removed anyway and the new ones wait for the next run.
+func ReindexKnowledgeBase() error {
+	if embedder == nil {
+		return nil
+	}
+
+	reindexMu.Lock()
+	defer reindexMu.Unlock()
+
+	entries, err := database.GetKnowledgeBaseEntries()
+	if err != nil {
+		return err
+	}
+
+	existing, err := database.GetKnowledgeChunks()
+	if err != nil {
+		return err
+	}
+
+	model := embedder.EmbeddingModelName()
+	cached := make(map[string][]float64)
+	for _, chunk := range existing {
+		if chunk.EmbeddingModel == model {
+			cached[chunk.ContentHash] = chunk.Embedding
+		}
+	}
+
+	var chunks []database.KnowledgeChunk
+	var missingTexts []string
+	var missingIdx []int
+	for _, entry := range entries {
+		for i, text := range chunkText(entry.Content, chunkSize) {
+			// Keep the document title with every chunk so retrieved pieces stay attributable
+			text = database.FormatKnowledgeDocument(entry.Title, text)
+			hash := hashText(text)
+			chunk := database.KnowledgeChunk{
+				KnowledgeBaseID: entry.ID,
+				ChunkIndex:      i,
+				Content:         text,
+				ContentHash:     hash,
+				EmbeddingModel:  model,
+			}
+			if vector, ok := cached[hash]; ok {
+				chunk.Embedding = vector
+			} else {
+				missingTexts = append(missingTexts, text)
+				missingIdx = append(missingIdx, len(chunks))
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	if len(missingTexts) > 0 {
+		log.Printf("[RAG] Embedding %d new chunks (%d reused)", len(missingTexts), len(chunks)-len(missingTexts))
+
+		ctx, cancel := context.WithTimeout(context.Background(), reindexTimeout)
+		defer cancel()
+
+		vectors, err := embedder.Embed(ctx, missingTexts)
+		if err != nil {
+			// Still drop the chunks of disabled, deleted and edited documents, keeping
+			// only the current text whose embedding is known
+			embedded := chunks[:0]
+			for _, chunk := range chunks {
+				if chunk.Embedding != nil {
+					embedded = append(embedded, chunk)
+				}
+			}
+			if replaceErr := database.ReplaceKnowledgeChunks(embedded); replaceErr != nil {
+				log.Printf("[RAG] Error removing outdated chunks: %v", replaceErr)
+			}
+			return err
+		}
+		for i, vector := range vectors {
+			chunks[missingIdx[i]].Embedding = vector
+		}
+	}
+
+	err = database.ReplaceKnowledgeChunks(chunks)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[RAG] Indexed %d chunks from %d knowledge base entries", len(chunks), len(entries))
+	return nil
+}
+
+// KnowledgeContext returns the knowledge base text to put in the prompt for a query:
+// the top-k most relevant chunks when retrieval is available, otherwise all enabled
+// documents.
+func KnowledgeContext(query string) string {
+	if embedder != nil {
+		relevant, err := retrieveChunks(query, retrievalTopK)
+		if err == nil && relevant != "" {
+			return relevant
+		}
+		if err != nil {
+			log.Printf("[RAG] Retrieval failed, falling back to full knowledge base: %v", err)
+		}
+	}
+
+	kb, err := database.GetKnowledgeBaseContext()
+	if err != nil {
+		log.Printf("[BOT] Error getting knowledge base: %v", err)
+		return ""
+	}
+	return kb
+}
+
+// retrieveChunks embeds the query and returns the k most similar chunks,
+// joined in their original document order
+func retrieveChunks(query string, k int) (string, error) {
+	chunks, err := database.GetKnowledgeChunks()
+	if err != nil || len(chunks) == 0 {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return "", err
+	}
+
+	type scored struct {
+		index int
+		score float64
+	}
+
+	model := embedder.EmbeddingModelName()
+	var results []scored
+	for i, chunk := range chunks {
+		if chunk.EmbeddingModel != model {
+			continue
+		}
+		results = append(results, scored{index: i, score: cosineSimilarity(vectors[0], chunk.Embedding)})
+	}
+
+	sort.Slice(results, func(a, b int) bool { return results[a].score > results[b].score })
+	if len(results) > k {
+		results = results[:k]
+	}
+
+	// Keep the selected chunks in document order so related lines stay readable
+	sort.Slice(results, func(a, b int) bool { return results[a].index < results[b].index })
+
+	var parts []string
+	for _, r := range results {
+		log.Printf("[RAG] Selected chunk %d (score %.3f)", chunks[r.index].ID, r.score)
+		parts = append(parts, chunks[r.index].Content)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// chunkText splits text into chunks of at most maxChars, breaking on paragraphs,
+// then lines, then words so that related sentences stay together
+func chunkText(text string, maxChars int) []string {
+	var pieces []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if len(paragraph) <= maxChars {
+			pieces = append(pieces, paragraph)
+			continue
+		}
+		for _, line := range strings.Split(paragraph, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			pieces = append(pieces, splitWords(line, maxChars)...)
+		}
+	}
+
+	// Merge small pieces back together up to maxChars
+	var chunks []string
+	var current strings.Builder
+	for _, piece := range pieces {
+		if current.Len() > 0 && current.Len()+1+len(piece) > maxChars {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(piece)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+
+	return chunks
+}
+
+// splitWords breaks a single long line on word boundaries
+func splitWords(line string, maxChars int) []string {
+	if len(line) <= maxChars {
+		return []string{line}
+	}
+
+	var parts []string
+	var current strings.Builder
+	for _, word := range strings.Fields(line) {
+		if current.Len() > 0 && current.Len()+1+len(word) > maxChars {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"telecust/database"
+	"testing"
+)
+
+// fakeEmbedder embeds every text as a one-dimensional vector, or fails when err is set
+type fakeEmbedder struct {
+	err error
+}
+
+func (e *fakeEmbedder) EmbeddingModelName() string { return "fake-embedding" }
+
+func (e *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(len(text))}
+	}
+	return vectors, nil
+}
+
+func TestReindexKnowledgeBaseDropsOutdatedChunksWhenEmbeddingFails(t *testing.T) {
+	useTestDB(t)
+	fake := &fakeEmbedder{}
+	previous := embedder
+	embedder = fake
+	t.Cleanup(func() { embedder = previous })
+
+	docs := map[string]*database.KnowledgeBase{}
+	for _, title := range []string{"Kept", "Disabled", "Edited"} {
+		doc := &database.KnowledgeBase{Title: title, Enabled: true, Content: title + " content"}
+		if err := database.CreateKnowledgeDocument(doc, "test"); err != nil {
+			t.Fatalf("CreateKnowledgeDocument: %v", err)
+		}
+		docs[title] = doc
+	}
+	if err := ReindexKnowledgeBase(); err != nil {
+		t.Fatalf("first ReindexKnowledgeBase: %v", err)
+	}
+
+	docs["Disabled"].Enabled = false
+	docs["Edited"].Content = "Edited content, second version"
+	for _, title := range []string{"Disabled", "Edited"} {
+		if err := database.UpdateKnowledgeDocument(docs[title], "test"); err != nil {
+			t.Fatalf("UpdateKnowledgeDocument: %v", err)
+		}
+	}
+
+	fake.err = errors.New("embedding service down")
+	if err := ReindexKnowledgeBase(); err == nil {
+		t.Fatal("ReindexKnowledgeBase succeeded, want the embedding error")
+	}
+
+	chunks, err := database.GetKnowledgeChunks()
+	if err != nil {
+		t.Fatalf("GetKnowledgeChunks: %v", err)
+	}
+	indexed := map[int]bool{}
+	for _, chunk := range chunks {
+		indexed[chunk.KnowledgeBaseID] = true
+	}
+	if !indexed[docs["Kept"].ID] {
+		t.Error("chunks of the unchanged document were removed")
+	}
+	if indexed[docs["Disabled"].ID] {
+		t.Error("chunks of the disabled document are still indexed")
+	}
+	if indexed[docs["Edited"].ID] {
+		t.Error("outdated chunks of the edited document are still indexed")
+	}
+}
@@ -0,0 +1,228 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"telecust/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// staffTakeoverPrefix is the callback prefix of the take-over button on staff
+// notifications, e.g. "takeover:12"
+const staffTakeoverPrefix = "takeover"
+
+// staffGroup posts notifications for admins to a Telegram group and mirrors
+// conversations into topics of a staff forum, configured with STAFF_CHAT_ID,
+// STAFF_FORUM_CHAT_ID and DASHBOARD_URL
+type staffGroup struct {
+	chatID       int64  // 0 disables notifications
+	forumChatID  int64  // 0 disables forum topics
+	dashboardURL string // Base URL of the dashboard for the "Open dashboard" button
+}
+
+func staffGroupFromEnv() staffGroup {
+	return staffGroup{
+		chatID:       staffChatIDFromEnv("STAFF_CHAT_ID"),
+		forumChatID:  staffChatIDFromEnv("STAFF_FORUM_CHAT_ID"),
+		dashboardURL: strings.TrimRight(os.Getenv("DASHBOARD_URL"), "/"),
+	}
+}
+
+// staffChatIDFromEnv reads a chat ID, 0 when unset or invalid
+func staffChatIDFromEnv(name string) int64 {
+	env := os.Getenv(name)
+	if env == "" {
+		return 0
+	}
+
+	chatID, err := strconv.ParseInt(env, 10, 64)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, ignoring it", name, env)
+		return 0
+	}
+	return chatID
+}
+
+// isStaffChat reports whether a chat is the staff group or forum rather than a customer
+func (b *Bot) isStaffChat(chatID int64) bool {
+	return chatID != 0 && (chatID == b.staff.chatID || chatID == b.staff.forumChatID)
+}
+
+// notifyStaff posts a notification about a conversation to the staff group, with
+// buttons to take it over and to open it in the dashboard
+func (b *Bot) notifyStaff(conv *database.Conversation, title, detail string) {
+	if b.staff.chatID == 0 {
+		return
+	}
+
+	text := fmt.Sprintf("%s\nCustomer: %s", title, staffCustomerLabel(conv))
+	if detail != "" {
+		text += "\n\n" + detail
+	}
+
+	msg := tgbotapi.NewMessage(b.staff.chatID, text)
+	msg.ReplyMarkup = b.staffKeyboard(conv.ID, true)
+	_, err := b.API.Send(msg)
+	if err != nil {
+		log.Printf("[STAFF] Error notifying staff group: %v", err)
+	}
+}
+
+// staffKeyboard builds the buttons of a staff notification. The take-over button is
+// left out once someone has used it.
+func (b *Bot) staffKeyboard(conversationID int, takeOver bool) *tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	if takeOver {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Take over", callbackData(staffTakeoverPrefix, strconv.Itoa(conversationID))))
+	}
+	if b.staff.dashboardURL != "" {
+		link := fmt.Sprintf("%s/?conversation=%d", b.staff.dashboardURL, conversationID)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("Open dashboard", link))
+	}
+	if len(row) == 0 {
+		return nil
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &markup
+}
+
+// staffAuditSource is stored as the address of audit entries for actions taken in
+// the staff group or forum
+const staffAuditSource = "telegram"
+
+// handleStaffCallback handles a button press on a staff notification. Agents linked to
+// a dashboard user may take a conversation over; replies are then sent from the
+// dashboard or the forum.
+func (b *Bot) handleStaffCallback(query *tgbotapi.CallbackQuery) {
+	log.Printf("[STAFF] Received callback from @%s: %s", query.From.UserName, query.Data)
+
+	prefix, arg, _ := strings.Cut(query.Data, ":")
+	id, err := strconv.Atoi(arg)
+	if prefix != staffTakeoverPrefix || err != nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	agent, denied := staffAgent(query.From)
+	if agent == nil {
+		log.Printf("[STAFF] Rejected take-over of conversation %d by Telegram user %d", id, query.From.ID)
+		b.answerCallback(query.ID, denied)
+		return
+	}
+
+	conv, err := database.GetConversation(id)
+	if err != nil {
+		log.Printf("[STAFF] Error loading conversation %d: %v", id, err)
+		b.answerCallback(query.ID, "Something went wrong, try again")
+		return
+	}
+	if conv == nil {
+		b.answerCallback(query.ID, "This conversation no longer exists")
+		return
+	}
+
+	err = takeOverAsAgent(conv, agent)
+	if err != nil {
+		log.Printf("[STAFF] Error taking over conversation %d: %v", conv.ID, err)
+		b.answerCallback(query.ID, "Something went wrong, try again")
+		return
+	}
+
+	log.Printf("[STAFF] %s took over conversation %d from the staff group", agent.Username, conv.ID)
+	if conv.AssignedAgent == agent.Username {
+		b.answerCallback(query.ID, "Bot paused, reply from the dashboard")
+	} else {
+		b.answerCallback(query.ID, "Bot paused, "+conv.AssignedAgent+" is handling this chat")
+	}
+
+	// Drop the take-over button so the group can see the chat is being handled
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\nTaken over by "+agent.Username)
+	edit.ReplyMarkup = b.staffKeyboard(conv.ID, false)
+	_, err = b.API.Send(edit)
+	if err != nil {
+		log.Printf("[STAFF] Error updating staff notification: %v", err)
+	}
+}
+
+// staffAgent returns the dashboard user a member of the staff chats acts for. It returns
+// nil and the reason to show them when their Telegram account is not linked to a
+// dashboard user or that user may not handle conversations.
+func staffAgent(from *tgbotapi.User) (*database.AdminUser, string) {
+	if from == nil {
+		return nil, "Unknown sender"
+	}
+
+	user, err := database.GetAdminUserByTelegramID(from.ID)
+	if err != nil {
+		log.Printf("[STAFF] Error looking up Telegram user %d: %v", from.ID, err)
+		return nil, "Something went wrong, try again"
+	}
+	if user == nil {
+		return nil, fmt.Sprintf("Your Telegram account (ID %d) is not linked to a dashboard user. Ask an owner to link it under Users.", from.ID)
+	}
+	if !user.HasRole(database.RoleAgent) {
+		return nil, fmt.Sprintf("%s is a %s and cannot handle conversations", user.Username, user.Role)
+	}
+	return user, ""
+}
+
+// takeOverAsAgent pauses the bot for a conversation and assigns it to the agent unless
+// someone already has it, like a take-over from the dashboard, and audits the action
+func takeOverAsAgent(conv *database.Conversation, agent *database.AdminUser) error {
+	before := conv.AssignmentState()
+
+	if conv.IsBotActive {
+		err := database.SetBotActive(conv.ID, false)
+		if err != nil {
+			return err
+		}
+		conv.IsBotActive = false
+	}
+
+	if conv.AssignedAgent == "" {
+		claimed, err := database.ClaimConversation(conv.ID, agent.Username)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			conv.AssignedAgent = agent.Username
+		}
+	}
+
+	auditStaffAction(agent, "conversation.takeover", conv.ID, before, conv.AssignmentState())
+	return nil
+}
+
+// auditStaffAction records an action an agent took in the staff group or forum in the
+// audit log, next to the ones taken through the dashboard
+func auditStaffAction(agent *database.AdminUser, action string, conversationID int, before, after interface{}) {
+	entry := &database.AuditEntry{
+		Actor:      agent.Username,
+		Action:     action,
+		TargetType: "conversation",
+		TargetID:   strconv.Itoa(conversationID),
+		Before:     database.AuditJSON(before),
+		After:      database.AuditJSON(after),
+		Status:     http.StatusOK,
+		IP:         staffAuditSource,
+	}
+
+	if err := database.SaveAuditEntry(entry); err != nil {
+		log.Printf("[STAFF] Error saving audit entry %q by %q: %v", entry.Action, entry.Actor, err)
+	}
+}
+
+// staffCustomerLabel names a customer with their username when they have one
+func staffCustomerLabel(conv *database.Conversation) string {
+	label := customerName(conv)
+	if conv.TelegramUsername != "" && label != "@"+conv.TelegramUsername {
+		label += " (@" + conv.TelegramUsername + ")"
+	}
+	return label
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telecust/database"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newTestAdmin creates a dashboard user linked to a Telegram account
+func newTestAdmin(t *testing.T, username, role string, telegramID int64) *database.AdminUser {
+	t.Helper()
+
+	user := &database.AdminUser{Username: username, Role: role}
+	if err := database.CreateAdminUser(user, "password123"); err != nil {
+		t.Fatalf("CreateAdminUser: %v", err)
+	}
+	if err := database.SetAdminTelegramID(user.ID, telegramID); err != nil {
+		t.Fatalf("SetAdminTelegramID: %v", err)
+	}
+	user.TelegramID = telegramID
+	return user
+}
+
+// staffAudit returns the audit entries written for a conversation
+func staffAudit(t *testing.T, conversationID int) []database.AuditEntry {
+	t.Helper()
+
+	entries, err := database.ListAuditEntries(database.AuditFilter{TargetType: "conversation", TargetID: strconv.Itoa(conversationID), Limit: 10})
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	return entries
+}
+
+func TestHandleStaffCallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		fromID       int64
+		assignedTo   string
+		wantAnswer   string
+		wantPaused   bool
+		wantAssigned string
+		wantAudit    bool
+	}{
+		{"unlinked sender", 900, "", "not linked", false, "", false},
+		{"viewer", 901, "", "cannot handle conversations", false, "", false},
+		{"agent claims the conversation", 902, "", "Bot paused, reply from the dashboard", true, "alice", true},
+		{"agent keeps the current assignment", 902, "bob", "bob is handling this chat", true, "bob", true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			b, telegram := newTestBot(t)
+			newTestAdmin(t, "viewer1", database.RoleViewer, 901)
+			newTestAdmin(t, "alice", database.RoleAgent, 902)
+
+			conv := newTestConversation(t, int64(5000+i))
+			if tt.assignedTo != "" {
+				if err := database.AssignConversation(conv.ID, tt.assignedTo); err != nil {
+					t.Fatalf("AssignConversation: %v", err)
+				}
+			}
+
+			b.handleStaffCallback(&tgbotapi.CallbackQuery{
+				ID:      "q1",
+				From:    &tgbotapi.User{ID: tt.fromID, FirstName: "Staff"},
+				Data:    callbackData(staffTakeoverPrefix, strconv.Itoa(conv.ID)),
+				Message: &tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: -100}, Text: "Handoff requested"},
+			})
+
+			answers := telegram.params("answerCallbackQuery", "text")
+			if len(answers) != 1 || !strings.Contains(answers[0], tt.wantAnswer) {
+				t.Errorf("callback answered %q, want it to contain %q", answers, tt.wantAnswer)
+			}
+
+			stored, err := database.GetConversation(conv.ID)
+			if err != nil {
+				t.Fatalf("GetConversation: %v", err)
+			}
+			if stored.IsBotActive == tt.wantPaused {
+				t.Errorf("IsBotActive = %v, want %v", stored.IsBotActive, !tt.wantPaused)
+			}
+			if stored.AssignedAgent != tt.wantAssigned {
+				t.Errorf("AssignedAgent = %q, want %q", stored.AssignedAgent, tt.wantAssigned)
+			}
+
+			entries := staffAudit(t, conv.ID)
+			if !tt.wantAudit {
+				if len(entries) != 0 {
+					t.Errorf("audit entries = %+v, want none", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].Actor != "alice" || entries[0].Action != "conversation.takeover" || entries[0].IP != staffAuditSource {
+				t.Errorf("audit entries = %+v, want one take-over by alice", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// defaultStreamEditInterval keeps edits well below Telegram's per-chat rate limit
+const defaultStreamEditInterval = 1500 * time.Millisecond
+
+// streamingReply progressively edits a single Telegram message while an AI reply
+// is being generated. The first chunk sends the message, later chunks edit it
+// at most once per interval, and Finish writes the final text.
+type streamingReply struct {
+	bot      *Bot
+	chatID   int64
+	interval time.Duration
+
+	mu        sync.Mutex
+	messageID int
+	sentText  string
+	lastEdit  time.Time
+}
+
+func (b *Bot) newStreamingReply(chatID int64) *streamingReply {
+	return &streamingReply{
+		bot:      b,
+		chatID:   chatID,
+		interval: b.StreamEditInterval,
+	}
+}
+
+// Update shows the partial reply, skipping edits that would exceed the rate limit
+func (s *streamingReply) Update(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text = strings.TrimSpace(text)
+	if text == "" || time.Since(s.lastEdit) < s.interval {
+		return
+	}
+
+	s.show(text, nil)
+}
+
+// Finish makes sure the message shows the final reply text, with optional inline buttons
+func (s *streamingReply) Finish(text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.show(text, markup)
+}
+
+func (s *streamingReply) show(text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	if text == s.sentText && markup == nil {
+		// Telegram rejects edits that do not change the message
+		return
+	}
+
+	if s.messageID == 0 {
+		msg := tgbotapi.NewMessage(s.chatID, text)
+		if markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		sent, err := s.bot.API.Send(msg)
+		if err != nil {
+			log.Printf("[BOT] Error sending streamed message: %v", err)
+			return
+		}
+		s.messageID = sent.MessageID
+	} else {
+		edit := tgbotapi.NewEditMessageText(s.chatID, s.messageID, text)
+		edit.ReplyMarkup = markup
+		_, err := s.bot.API.Send(edit)
+		if err != nil {
+			log.Printf("[BOT] Error editing streamed message: %v", err)
+			return
+		}
+	}
+
+	s.sentText = text
+	s.lastEdit = time.Now()
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"telecust/database"
+	"time"
+)
+
+// takeoverCheckInterval is how often paused conversations are checked for idle agents
+const takeoverCheckInterval = time.Minute
+
+// takeoverTimeout resumes the bot in conversations whose agent has gone quiet,
+// configured with TAKEOVER_TIMEOUT_MINUTES and TAKEOVER_TIMEOUT_MESSAGE
+type takeoverTimeout struct {
+	minutes int    // Default idle minutes before the bot resumes, 0 = never
+	message string // Sent to the customer when the bot resumes, empty sends nothing
+}
+
+func takeoverTimeoutFromEnv() takeoverTimeout {
+	t := takeoverTimeout{message: os.Getenv("TAKEOVER_TIMEOUT_MESSAGE")}
+	if env := os.Getenv("TAKEOVER_TIMEOUT_MINUTES"); env != "" {
+		if minutes, err := strconv.Atoi(env); err == nil && minutes > 0 {
+			t.minutes = minutes
+		}
+	}
+	return t
+}
+
+// watchTakeovers resumes idle conversations until the process exits
+func (b *Bot) watchTakeovers() {
+	ticker := time.NewTicker(takeoverCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		b.resumeIdleTakeovers()
+	}
+}
+
+// resumeIdleTakeovers re-enables the bot in every conversation where no admin has
+// written for longer than its takeover timeout, and releases it from its agent
+func (b *Bot) resumeIdleTakeovers() {
+	conversations, err := database.GetIdleTakeovers(b.takeover.minutes)
+	if err != nil {
+		log.Printf("[BOT] Error checking takeover timeouts: %v", err)
+		return
+	}
+
+	for i := range conversations {
+		conv := &conversations[i]
+		minutes := b.takeover.minutes
+		if conv.TakeoverTimeout != nil {
+			minutes = *conv.TakeoverTimeout
+		}
+		log.Printf("[BOT] Resuming bot in conversation %d after %d minutes without an admin reply", conv.ID, minutes)
+
+		err := database.SetBotActive(conv.ID, true)
+		if err != nil {
+			log.Printf("[BOT] Error resuming bot: %v", err)
+			continue
+		}
+		if conv.AssignedAgent != "" {
+			err = database.AssignConversation(conv.ID, "")
+			if err != nil {
+				log.Printf("[BOT] Error releasing conversation %d: %v", conv.ID, err)
+			}
+		}
+
+		label := fmt.Sprintf("Bot resumed after %d minutes without an admin reply", minutes)
+		err = database.SaveConversationEvent(&database.ConversationEvent{
+			ConversationID: conv.ID,
+			Type:           database.EventBotResumed,
+			Label:          label,
+			Data:           strconv.Itoa(minutes),
+		})
+		if err != nil {
+			log.Printf("[BOT] Error saving bot resumed event: %v", err)
+		}
+		b.notifyStaff(conv, label, "")
+
+		if b.takeover.message != "" {
+			b.sendMessage(conv.TelegramChatID, b.takeover.message)
+			err = database.SaveMessage(conv.ID, "bot", b.takeover.message)
+			if err != nil {
+				log.Printf("[BOT] Error saving takeover timeout message: %v", err)
+			}
+		}
+	}
+}
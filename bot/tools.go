@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"telecust/database"
+	"time"
+)
+
+// maxToolRounds limits how many times the model may call tools before it must answer
+const maxToolRounds = 5
+
+// ToolContext tells a tool which conversation it is running for
+type ToolContext struct {
+	ConversationID int
+	Reply          *Reply // The reply being produced, so tools can attach results to it
+}
+
+// Tool is a Go function the model can call to look up structured data
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema of the arguments object
+	Handler     func(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error)
+}
+
+var (
+	toolsMu   sync.RWMutex
+	tools     = map[string]*Tool{}
+	toolOrder []string
+)
+
+// RegisterTool makes a tool available to the model. Registering a name twice replaces the tool.
+func RegisterTool(tool Tool) {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+
+	if _, exists := tools[tool.Name]; !exists {
+		toolOrder = append(toolOrder, tool.Name)
+	}
+	tools[tool.Name] = &tool
+}
+
+// toolDefinitions returns all registered tools in the provider request format
+func toolDefinitions() []ToolDefinition {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+
+	var defs []ToolDefinition
+	for _, name := range toolOrder {
+		tool := tools[name]
+		defs = append(defs, ToolDefinition{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// executeToolCall runs a tool requested by the model, logs it to the database and
+// returns the JSON result (or error) to feed back to the model
+func executeToolCall(ctx context.Context, tc ToolContext, call ToolCall) string {
+	start := time.Now()
+	entry := &database.ToolCallLog{
+		ConversationID: tc.ConversationID,
+		ToolName:       call.Function.Name,
+		Arguments:      call.Function.Arguments,
+	}
+
+	toolsMu.RLock()
+	tool, ok := tools[call.Function.Name]
+	toolsMu.RUnlock()
+
+	var result interface{}
+	var err error
+	if !ok {
+		err = fmt.Errorf("unknown tool %q", call.Function.Name)
+	} else {
+		args := json.RawMessage(call.Function.Arguments)
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		result, err = tool.Handler(ctx, tc, args)
+	}
+
+	var output string
+	if err != nil {
+		entry.Error = err.Error()
+		output = mustJSON(map[string]string{"error": err.Error()})
+	} else {
+		output = mustJSON(result)
+	}
+	entry.Result = output
+	entry.DurationMs = time.Since(start).Milliseconds()
+
+	log.Printf("[TOOLS] %s(%s) -> %s (%d ms)", entry.ToolName, entry.Arguments, output, entry.DurationMs)
+	if saveErr := database.SaveToolCall(entry); saveErr != nil {
+		log.Printf("[TOOLS] Error saving tool call: %v", saveErr)
+	}
+
+	return output
+}
+
+// runCompletion asks the provider for a reply, running any tools the model calls and
+// feeding their results back until it produces a final answer. When onUpdate is set
+// and the provider can stream, partial text of the current round is reported.
+func runCompletion(ctx context.Context, provider Provider, messages []Message, tc ToolContext, onUpdate func(text string)) (*Completion, error) {
+	defs := toolDefinitions()
+	streamer, canStream := provider.(StreamingProvider)
+	var usage Usage
+
+	for round := 0; ; round++ {
+		opts := CompletionOptions{Tools: defs}
+		if round == maxToolRounds {
+			// Out of tool rounds, force a plain answer
+			log.Printf("[AI] Tool round limit reached, asking for a final answer")
+			opts.Tools = nil
+		}
+
+		var completion *Completion
+		var err error
+		if canStream && onUpdate != nil {
+			var partial string
+			completion, err = streamer.Stream(ctx, messages, opts, func(delta string) {
+				partial += delta
+				onUpdate(partial)
+			})
+		} else {
+			completion, err = provider.Complete(ctx, messages, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Add(completion.Usage)
+		if len(completion.ToolCalls) == 0 || round >= maxToolRounds {
+			// A model that still calls tools after the limit gets no more rounds
+			completion.ToolCalls = nil
+			completion.Usage = usage
+			return completion, nil
+		}
+
+		log.Printf("[AI] Model requested %d tool calls (round %d)", len(completion.ToolCalls), round+1)
+		messages = append(messages, Message{
+			Role:      "assistant",
+			Content:   completion.Content,
+			ToolCalls: completion.ToolCalls,
+		})
+		for _, call := range completion.ToolCalls {
+			messages = append(messages, Message{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    executeToolCall(ctx, tc, call),
+			})
+		}
+	}
+}
+
+func mustJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
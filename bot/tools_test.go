@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "test_echo",
+		Description: "Returns its arguments, for tests",
+		Parameters:  map[string]interface{}{"type": "object"},
+		Handler: func(ctx context.Context, tc ToolContext, args json.RawMessage) (interface{}, error) {
+			return map[string]json.RawMessage{"echo": args}, nil
+		},
+	})
+}
+
+// toolCallResponse is a completion asking for one tool call
+func toolCallResponse(id, name, args string) fakeResponse {
+	return fakeResponse{completion: Completion{
+		ToolCalls: []ToolCall{{ID: id, Type: "function", Function: ToolCallFunction{Name: name, Arguments: args}}},
+		Usage:     Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11},
+	}}
+}
+
+func answerResponse(text string) fakeResponse {
+	return fakeResponse{completion: Completion{
+		Content: text,
+		Usage:   Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25},
+	}}
+}
+
+func TestRunCompletion(t *testing.T) {
+	tests := []struct {
+		name        string
+		responses   []fakeResponse
+		wantText    string
+		wantCalls   int
+		wantTokens  int
+		wantResults []string // Content of the tool messages sent back, in order
+	}{
+		{
+			name:       "answer without tools",
+			responses:  []fakeResponse{answerResponse("Jawaban")},
+			wantText:   "Jawaban",
+			wantCalls:  1,
+			wantTokens: 25,
+		},
+		{
+			name: "tool result is fed back",
+			responses: []fakeResponse{
+				toolCallResponse("call-1", "test_echo", `{"q":1}`),
+				answerResponse("Selesai"),
+			},
+			wantText:    "Selesai",
+			wantCalls:   2,
+			wantTokens:  36,
+			wantResults: []string{`{"echo":{"q":1}}`},
+		},
+		{
+			name: "unknown tool returns an error to the model",
+			responses: []fakeResponse{
+				toolCallResponse("call-1", "no_such_tool", `{}`),
+				answerResponse("Maaf"),
+			},
+			wantText:    "Maaf",
+			wantCalls:   2,
+			wantTokens:  36,
+			wantResults: []string{`{"error":"unknown tool \"no_such_tool\""}`},
+		},
+		{
+			name: "tool rounds are cut off",
+			// The model never stops calling tools; the script repeats its last entry
+			responses:  []fakeResponse{toolCallResponse("call-n", "test_echo", `{}`)},
+			wantCalls:  maxToolRounds + 1,
+			wantTokens: (maxToolRounds + 1) * 11,
+			wantResults: []string{
+				`{"echo":{}}`, `{"echo":{}}`, `{"echo":{}}`, `{"echo":{}}`, `{"echo":{}}`,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			conv := newTestConversation(t, int64(3000+i))
+			provider := &fakeProvider{responses: tt.responses}
+
+			messages := []Message{{Role: "system", Content: "prompt"}, {Role: "user", Content: "pertanyaan"}}
+			completion, err := runCompletion(context.Background(), provider, messages, ToolContext{ConversationID: conv.ID, Reply: &Reply{}}, nil)
+			if err != nil {
+				t.Fatalf("runCompletion: %v", err)
+			}
+
+			if completion.Content != tt.wantText {
+				t.Errorf("Content = %q, want %q", completion.Content, tt.wantText)
+			}
+			if len(provider.requests) != tt.wantCalls {
+				t.Fatalf("provider called %d times, want %d", len(provider.requests), tt.wantCalls)
+			}
+			if completion.Usage.TotalTokens != tt.wantTokens {
+				t.Errorf("TotalTokens = %d, want %d", completion.Usage.TotalTokens, tt.wantTokens)
+			}
+
+			// Tools are offered on every round except the last allowed one
+			for round, req := range provider.requests {
+				offered := len(req.opts.Tools) > 0
+				if want := round < maxToolRounds; offered != want {
+					t.Errorf("round %d offered tools = %v, want %v", round, offered, want)
+				}
+			}
+
+			last := provider.requests[len(provider.requests)-1].messages
+			var results []string
+			for _, m := range last {
+				if m.Role == "tool" {
+					results = append(results, m.Content)
+				}
+			}
+			if strings.Join(results, "\n") != strings.Join(tt.wantResults, "\n") {
+				t.Errorf("tool results = %q, want %q", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func TestRunCompletionStreamsEachRound(t *testing.T) {
+	useTestDB(t)
+	conv := newTestConversation(t, 3100)
+	provider := &fakeStreamingProvider{chunkSize: 3, fakeProvider: fakeProvider{responses: []fakeResponse{
+		toolCallResponse("call-1", "test_echo", `{}`),
+		answerResponse("Halo kak"),
+	}}}
+
+	var updates []string
+	completion, err := runCompletion(context.Background(), provider, []Message{{Role: "user", Content: "x"}},
+		ToolContext{ConversationID: conv.ID, Reply: &Reply{}}, func(text string) { updates = append(updates, text) })
+	if err != nil {
+		t.Fatalf("runCompletion: %v", err)
+	}
+
+	if completion.Content != "Halo kak" {
+		t.Errorf("Content = %q, want %q", completion.Content, "Halo kak")
+	}
+	want := []string{"Hal", "Halo k", "Halo kak"}
+	if strings.Join(updates, "|") != strings.Join(want, "|") {
+		t.Errorf("updates = %q, want %q", updates, want)
+	}
+}
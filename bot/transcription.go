@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"telecust/database"
+	"time"
+)
+
+// transcriptionTimeout bounds a single speech-to-text request
+const transcriptionTimeout = 2 * time.Minute
+
+// Transcriber turns recorded speech into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, fileName string, audio []byte) (string, error)
+}
+
+var activeTranscriber Transcriber
+
+// SetTranscriber replaces the speech-to-text backend, e.g. with a fake in tests.
+// nil disables transcription.
+func SetTranscriber(t Transcriber) {
+	activeTranscriber = t
+}
+
+// InitTranscription configures voice message transcription from the environment.
+// It is enabled when a transcription endpoint or API key is available and can be
+// turned off with TRANSCRIPTION_ENABLED=false.
+func InitTranscription() error {
+	if os.Getenv("TRANSCRIPTION_ENABLED") == "false" {
+		log.Println("Voice transcription disabled (TRANSCRIPTION_ENABLED=false)")
+		return nil
+	}
+
+	customBase := os.Getenv("TRANSCRIPTION_API_BASE")
+	apiKey := firstNonEmpty(os.Getenv("TRANSCRIPTION_API_KEY"), os.Getenv("OPENAI_API_KEY"))
+	if customBase == "" && apiKey == "" {
+		log.Println("No transcription endpoint configured, voice messages will not be transcribed")
+		return nil
+	}
+
+	t := &OpenAITranscriber{
+		APIBase:  strings.TrimRight(firstNonEmpty(customBase, os.Getenv("OPENAI_API_BASE"), "https://api.openai.com/v1"), "/"),
+		APIKey:   apiKey,
+		Model:    firstNonEmpty(os.Getenv("TRANSCRIPTION_MODEL"), "whisper-1"),
+		Language: firstNonEmpty(os.Getenv("TRANSCRIPTION_LANGUAGE"), "id"),
+	}
+	SetTranscriber(t)
+
+	log.Printf("Voice transcription enabled (base: %s, model: %s, language: %s)", t.APIBase, t.Model, t.Language)
+	return nil
+}
+
+// OpenAITranscriber calls an OpenAI-compatible /audio/transcriptions endpoint
+type OpenAITranscriber struct {
+	APIBase  string
+	APIKey   string // Optional for local endpoints
+	Model    string
+	Language string // ISO-639-1 hint, empty to auto-detect
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, fileName string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", err
+	}
+	form.WriteField("model", t.Model)
+	form.WriteField("response_format", "json")
+	if t.Language != "" {
+		form.WriteField("language", t.Language)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	url := t.APIBase + "/audio/transcriptions"
+	log.Printf("[STT] POST %s (%d bytes)", url, body.Len())
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("STT API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal(respBody, &result)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
+
+// transcribeAttachment downloads a voice or audio attachment and stores its transcript.
+// It does nothing when transcription is not configured.
+func (b *Bot) transcribeAttachment(att *database.Attachment) error {
+	if activeTranscriber == nil {
+		return nil
+	}
+	if att.Kind != database.AttachmentVoice && att.Kind != database.AttachmentAudio {
+		return nil
+	}
+
+	localPath := att.LocalPath
+	if localPath == "" {
+		var err error
+		localPath, err = b.DownloadAttachment(att)
+		if err != nil {
+			return err
+		}
+	}
+
+	audio, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcriptionTimeout)
+	defer cancel()
+
+	start := time.Now()
+	transcript, err := activeTranscriber.Transcribe(ctx, filepath.Base(localPath), audio)
+	if err != nil {
+		return err
+	}
+	log.Printf("[STT] Transcribed attachment %d in %s: %s", att.ID, time.Since(start).Round(time.Millisecond), transcript)
+
+	att.Transcript = transcript
+	return database.SetAttachmentTranscript(att.ID, transcript)
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"telecust/database"
+	"testing"
+)
+
+// fakeTranscriber returns a fixed transcript and records the audio it was given
+type fakeTranscriber struct {
+	transcript string
+	audio      []byte
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, fileName string, audio []byte) (string, error) {
+	f.audio = audio
+	return f.transcript, nil
+}
+
+// useTranscriber makes t the active transcriber for the rest of the test
+func useTranscriber(t *testing.T, transcriber Transcriber) {
+	t.Helper()
+
+	previous := activeTranscriber
+	SetTranscriber(transcriber)
+	t.Cleanup(func() { SetTranscriber(previous) })
+}
+
+// saveTestVoiceMessage stores a voice message whose file is already downloaded
+func saveTestVoiceMessage(t *testing.T, conv *database.Conversation) database.Message {
+	t.Helper()
+
+	localPath := filepath.Join(t.TempDir(), "voice.ogg")
+	err := os.WriteFile(localPath, []byte("OggS fake audio"), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	att := &database.Attachment{Kind: database.AttachmentVoice, FileID: "voice-file", LocalPath: localPath}
+	err = database.SaveMessageWithAttachment(conv.ID, "user", "", "", att)
+	if err != nil {
+		t.Fatalf("SaveMessageWithAttachment: %v", err)
+	}
+	return database.Message{Attachments: []database.Attachment{*att}}
+}
+
+func TestRespondToVoiceMessage(t *testing.T) {
+	t.Run("transcribed and answered", func(t *testing.T) {
+		useTestDB(t)
+		provider := &fakeProvider{responses: []fakeResponse{{completion: Completion{Content: "Harga kopi Rp20.000 kak"}}}}
+		useFakeProvider(t, provider)
+		transcriber := &fakeTranscriber{transcript: "berapa harga kopi"}
+		useTranscriber(t, transcriber)
+
+		b, telegram := newTestBot(t)
+		conv := newTestConversation(t, 100)
+		msg := saveTestVoiceMessage(t, conv)
+
+		b.respondToAttachment(conv.TelegramChatID, conv, msg)
+
+		if string(transcriber.audio) != "OggS fake audio" {
+			t.Errorf("transcriber got %q, want the downloaded file", transcriber.audio)
+		}
+		att, err := database.GetAttachment(msg.Attachments[0].ID)
+		if err != nil || att.Transcript != "berapa harga kopi" {
+			t.Errorf("stored transcript = %+v, %v, want %q", att, err, "berapa harga kopi")
+		}
+
+		if len(provider.requests) != 1 {
+			t.Fatalf("provider got %d requests, want 1", len(provider.requests))
+		}
+		messages := provider.requests[0].messages
+		if last := messages[len(messages)-1].Content; !strings.Contains(last, "berapa harga kopi") {
+			t.Errorf("AI was asked %q, want the transcript", last)
+		}
+
+		sent := telegram.sent("sendMessage")
+		if len(sent) != 1 || sent[0] != "Harga kopi Rp20.000 kak" {
+			t.Errorf("sent %q, want the AI reply", sent)
+		}
+	})
+
+	t.Run("no transcriber configured", func(t *testing.T) {
+		useTestDB(t)
+		provider := &fakeProvider{}
+		useFakeProvider(t, provider)
+		useTranscriber(t, nil)
+
+		b, telegram := newTestBot(t)
+		conv := newTestConversation(t, 100)
+		msg := saveTestVoiceMessage(t, conv)
+
+		b.respondToAttachment(conv.TelegramChatID, conv, msg)
+
+		if len(provider.requests) != 0 {
+			t.Errorf("provider got %d requests, want none", len(provider.requests))
+		}
+		sent := telegram.sent("sendMessage")
+		if len(sent) != 1 || !strings.Contains(sent[0], "pesan suara belum bisa") {
+			t.Errorf("sent %q, want the voice message notice", sent)
+		}
+	})
+}
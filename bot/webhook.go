@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// WebhookPath is the route on the HTTP server that receives Telegram updates in webhook mode
+const WebhookPath = "/telegram/webhook"
+
+// webhookSecretHeader carries the secret token Telegram was given in setWebhook
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxWebhookBody bounds the size of a single update
+const maxWebhookBody = 1 << 20
+
+// Telegram only accepts 1-256 characters of A-Z, a-z, 0-9, _ and - as secret token
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// configureWebhook enables webhook mode when TELEGRAM_WEBHOOK_URL is set. The secret
+// is required so that only Telegram can post updates to the public route.
+func (b *Bot) configureWebhook(baseURL, secret string) error {
+	if baseURL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(baseURL, "https://") {
+		return fmt.Errorf("TELEGRAM_WEBHOOK_URL must be an https URL")
+	}
+	if !webhookSecretPattern.MatchString(secret) {
+		return fmt.Errorf("TELEGRAM_WEBHOOK_SECRET is required in webhook mode (1-256 characters: A-Z, a-z, 0-9, _ and -)")
+	}
+
+	b.WebhookURL = strings.TrimRight(baseURL, "/") + WebhookPath
+	b.WebhookSecret = secret
+	return nil
+}
+
+// WebhookEnabled reports whether updates arrive through the webhook instead of long polling
+func (b *Bot) WebhookEnabled() bool {
+	return b.WebhookURL != ""
+}
+
+// setWebhook registers the webhook URL and secret token with Telegram. The library's
+// WebhookConfig has no secret_token field, so the request is built by hand.
+func (b *Bot) setWebhook() error {
+	params := tgbotapi.Params{
+		"url":          b.WebhookURL,
+		"secret_token": b.WebhookSecret,
+	}
+	err := params.AddInterface("allowed_updates", []string{"message", "callback_query"})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.API.MakeRequest("setWebhook", params)
+	return err
+}
+
+// deleteWebhook removes a webhook left over from webhook mode, since Telegram refuses
+// long polling while one is set
+func (b *Bot) deleteWebhook() {
+	info, err := b.API.GetWebhookInfo()
+	if err != nil {
+		log.Printf("[BOT] Error checking webhook: %v", err)
+		return
+	}
+	if !info.IsSet() {
+		return
+	}
+
+	_, err = b.API.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		log.Printf("[BOT] Error deleting webhook: %v", err)
+		return
+	}
+	log.Printf("[BOT] Deleted webhook %s to use long polling", info.URL)
+}
+
+// HandleWebhook receives an update from Telegram and feeds it to the same handler as
+// long polling. Requests without the configured secret token are rejected.
+func (b *Bot) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(b.WebhookSecret)) != 1 {
+		log.Printf("[BOT] Rejected webhook request from %s: invalid secret token", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	update, topicID, err := decodeUpdate(data)
+	if err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	// Acknowledge right away, Telegram retries updates that are not answered quickly
+	w.WriteHeader(http.StatusOK)
+	b.handleUpdate(update, topicID)
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for dashboard logins
+const MinPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// ValidateUsername checks that a username is 3-32 letters, digits, '_', '.' or '-'
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("username must be 3-32 characters: letters, digits, '_', '.' or '-'")
+	}
+	return nil
+}
+
+// ValidatePassword checks a new password before it is hashed
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	// bcrypt ignores everything after 72 bytes
+	if len(password) > 72 {
+		return fmt.Errorf("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+// roleRank orders roles by how much they may do
+var roleRank = map[string]int{RoleViewer: 1, RoleAgent: 2, RoleOwner: 3}
+
+// ValidRole reports whether role is a known dashboard role
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// HasRole reports whether the user has at least the given role
+func (u *AdminUser) HasRole(role string) bool {
+	return roleRank[u.Role] >= roleRank[role]
+}
+
+// dummyHash is compared against when a username does not exist, so a failed login
+// takes as long for unknown users as for wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("telecust-dummy-password"), bcrypt.DefaultCost)
+
+const adminUserColumns = "id, username, password_hash, role, telegram_id, last_login_at, created_at, updated_at"
+
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (*AdminUser, error) {
+	var u AdminUser
+	var lastLoginAt sql.NullString
+	var createdAt, updatedAt string
+
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.TelegramID, &lastLoginAt, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastLoginAt.Valid {
+		t := parseTime(lastLoginAt.String)
+		u.LastLoginAt = &t
+	}
+	u.CreatedAt = parseTime(createdAt)
+	u.UpdatedAt = parseTime(updatedAt)
+	return &u, nil
+}
+
+// ListAdminUsers returns all dashboard users ordered by username
+func ListAdminUsers() ([]AdminUser, error) {
+	rows, err := DB.Query("SELECT " + adminUserColumns + " FROM admin_users ORDER BY username ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []AdminUser
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+// CountAdminUsers returns how many dashboard users exist
+func CountAdminUsers() (int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM admin_users").Scan(&count)
+	return count, err
+}
+
+// GetAdminUser returns a dashboard user, or nil if it does not exist
+func GetAdminUser(id int) (*AdminUser, error) {
+	u, err := scanAdminUser(DB.QueryRow("SELECT "+adminUserColumns+" FROM admin_users WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// GetAdminUserByUsername returns a dashboard user by username (case-insensitive), or nil if it does not exist
+func GetAdminUserByUsername(username string) (*AdminUser, error) {
+	u, err := scanAdminUser(DB.QueryRow("SELECT "+adminUserColumns+" FROM admin_users WHERE username = ? COLLATE NOCASE", username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// GetAdminUserByTelegramID returns the dashboard user linked to a Telegram user, or
+// nil if there is none
+func GetAdminUserByTelegramID(telegramID int64) (*AdminUser, error) {
+	if telegramID == 0 {
+		return nil, nil
+	}
+
+	u, err := scanAdminUser(DB.QueryRow("SELECT "+adminUserColumns+" FROM admin_users WHERE telegram_id = ?", telegramID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// CountOwners returns how many users have the owner role
+func CountOwners() (int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM admin_users WHERE role = ?", RoleOwner).Scan(&count)
+	return count, err
+}
+
+// CreateAdminUser stores a new dashboard user with a bcrypt hash of password and sets its ID
+func CreateAdminUser(u *AdminUser, password string) error {
+	u.Username = strings.TrimSpace(u.Username)
+	if err := ValidateUsername(u.Username); err != nil {
+		return err
+	}
+	if !ValidRole(u.Role) {
+		return fmt.Errorf("invalid role %q", u.Role)
+	}
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	existing, err := GetAdminUserByUsername(u.Username)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("username %q is already taken", u.Username)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+
+	result, err := DB.Exec(`
+		INSERT INTO admin_users (username, password_hash, role) VALUES (?, ?, ?)
+	`, u.Username, u.PasswordHash, u.Role)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	u.ID = int(id)
+	return nil
+}
+
+// SetAdminPassword replaces a dashboard user's password
+func SetAdminPassword(id int, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(`
+		UPDATE admin_users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, string(hash), id)
+	return err
+}
+
+// SetAdminRole changes a dashboard user's role
+func SetAdminRole(id int, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+
+	_, err := DB.Exec(`
+		UPDATE admin_users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, role, id)
+	return err
+}
+
+// SetAdminTelegramID links a dashboard user to a Telegram user, 0 unlinks it. A Telegram
+// user can act for only one dashboard user.
+func SetAdminTelegramID(id int, telegramID int64) error {
+	if telegramID < 0 {
+		return fmt.Errorf("invalid Telegram user ID %d", telegramID)
+	}
+
+	existing, err := GetAdminUserByTelegramID(telegramID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != id {
+		return fmt.Errorf("Telegram user %d is already linked to %q", telegramID, existing.Username)
+	}
+
+	_, err = DB.Exec(`
+		UPDATE admin_users SET telegram_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, telegramID, id)
+	return err
+}
+
+// DeleteAdminUser removes a dashboard user
+func DeleteAdminUser(id int) error {
+	_, err := DB.Exec("DELETE FROM admin_users WHERE id = ?", id)
+	return err
+}
+
+// AuthenticateAdmin checks a username and password and records the login. It returns
+// nil without an error when the credentials are wrong.
+func AuthenticateAdmin(username, password string) (*AdminUser, error) {
+	u, err := GetAdminUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, nil
+	}
+
+	_, err = DB.Exec("UPDATE admin_users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?", u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"telecust/events"
+	"time"
+)
+
+// SaveMessageWithAttachment saves a message together with the file it carries. sentBy
+// names the dashboard user for admin messages.
+func SaveMessageWithAttachment(conversationID int, senderType, sentBy, messageText string, att *Attachment) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	messageID, err := insertMessage(tx, conversationID, senderType, sentBy, messageText, nil)
+	if err != nil {
+		return err
+	}
+
+	att.MessageID = messageID
+	att.ConversationID = conversationID
+	result, err := tx.Exec(`
+		INSERT INTO attachments (message_id, conversation_id, kind, file_id, file_unique_id, file_name,
+			mime_type, file_size, caption, width, height, duration, emoji, local_path, transcript)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, att.MessageID, att.ConversationID, att.Kind, att.FileID, att.FileUniqueID, att.FileName,
+		att.MimeType, att.FileSize, att.Caption, att.Width, att.Height, att.Duration, att.Emoji, att.LocalPath,
+		att.Transcript)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	att.ID = int(id)
+	att.Downloaded = att.LocalPath != ""
+	att.CreatedAt = time.Now()
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	publishMessage(&Message{ID: messageID, ConversationID: conversationID, SenderType: senderType,
+		SentBy: sentBy, MessageText: messageText, Attachments: []Attachment{*att}})
+	return nil
+}
+
+const attachmentColumns = `id, message_id, conversation_id, kind, file_id, file_unique_id, file_name,
+	mime_type, file_size, caption, width, height, duration, emoji, local_path, transcript, created_at`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*Attachment, error) {
+	var att Attachment
+	var createdAt string
+
+	err := row.Scan(&att.ID, &att.MessageID, &att.ConversationID, &att.Kind, &att.FileID, &att.FileUniqueID,
+		&att.FileName, &att.MimeType, &att.FileSize, &att.Caption, &att.Width, &att.Height, &att.Duration,
+		&att.Emoji, &att.LocalPath, &att.Transcript, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	att.CreatedAt = parseTime(createdAt)
+	att.Downloaded = att.LocalPath != ""
+	return &att, nil
+}
+
+// loadMessageAttachments fills in the attachments of the given messages
+func loadMessageAttachments(messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Message)
+	placeholders := make([]string, len(messages))
+	args := make([]interface{}, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+		placeholders[i] = "?"
+		args[i] = messages[i].ID
+	}
+
+	rows, err := DB.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE message_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			return err
+		}
+		if msg, ok := byID[att.MessageID]; ok {
+			msg.Attachments = append(msg.Attachments, *att)
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetAttachment returns an attachment, or nil if it does not exist
+func GetAttachment(id int) (*Attachment, error) {
+	att, err := scanAttachment(DB.QueryRow("SELECT "+attachmentColumns+" FROM attachments WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return att, err
+}
+
+// SetAttachmentLocalPath records where a downloaded attachment is stored
+func SetAttachmentLocalPath(id int, path string) error {
+	_, err := DB.Exec("UPDATE attachments SET local_path = ? WHERE id = ?", path, id)
+	return err
+}
+
+// SetAttachmentTranscript stores the speech-to-text transcript of a voice or audio attachment
+func SetAttachmentTranscript(id int, transcript string) error {
+	_, err := DB.Exec("UPDATE attachments SET transcript = ? WHERE id = ?", transcript, id)
+	if err != nil {
+		return err
+	}
+
+	var conversationID, messageID int
+	err = DB.QueryRow("SELECT conversation_id, message_id FROM attachments WHERE id = ?", id).Scan(&conversationID, &messageID)
+	if err != nil {
+		return err
+	}
+
+	events.Publish(events.Event{
+		Type:           events.MessageUpdated,
+		ConversationID: conversationID,
+		Data:           map[string]int{"message_id": messageID},
+	})
+	return nil
+}
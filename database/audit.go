@@ -0,0 +1,99 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuditJSON encodes the before or after data of an audit entry, empty for nil
+func AuditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// AssignmentState is the audited state of a conversation's assignment, the same for
+// changes made in the dashboard and in the staff chats
+func (c *Conversation) AssignmentState() map[string]interface{} {
+	return map[string]interface{}{"assigned_agent": c.AssignedAgent, "is_bot_active": c.IsBotActive}
+}
+
+// SaveAuditEntry stores an audit log entry and sets its ID
+func SaveAuditEntry(entry *AuditEntry) error {
+	result, err := DB.Exec(`
+		INSERT INTO audit_log (actor, action, target_type, target_id, before_data, after_data, status, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Actor, entry.Action, entry.TargetType, entry.TargetID, entry.Before, entry.After, entry.Status, entry.IP)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	entry.ID = int(id)
+	entry.CreatedAt = time.Now()
+	return nil
+}
+
+// ListAuditEntries returns audit log entries matching the filter, newest first
+func ListAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT id, actor, action, target_type, target_id, before_data, after_data, status, ip, created_at
+		FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if filter.Actor != "" {
+		query += " AND actor = ? COLLATE NOCASE"
+		args = append(args, filter.Actor)
+	}
+	if strings.HasSuffix(filter.Action, ".") {
+		query += " AND substr(action, 1, ?) = ?"
+		args = append(args, len(filter.Action), filter.Action)
+	} else if filter.Action != "" {
+		query += " AND action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.Until.UTC().Format("2006-01-02 15:04:05"))
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var createdAt string
+
+		err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.Before, &e.After, &e.Status, &e.IP, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		e.CreatedAt = parseTime(createdAt)
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
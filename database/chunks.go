@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// GetKnowledgeChunks returns all stored chunks, ordered by knowledge base entry and position
+func GetKnowledgeChunks() ([]KnowledgeChunk, error) {
+	rows, err := DB.Query(`
+		SELECT id, knowledge_base_id, chunk_index, content, content_hash, embedding, embedding_model, created_at
+		FROM kb_chunks
+		ORDER BY knowledge_base_id ASC, chunk_index ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []KnowledgeChunk
+	for rows.Next() {
+		var chunk KnowledgeChunk
+		var embedding []byte
+		var createdAt string
+
+		err := rows.Scan(&chunk.ID, &chunk.KnowledgeBaseID, &chunk.ChunkIndex, &chunk.Content,
+			&chunk.ContentHash, &embedding, &chunk.EmbeddingModel, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk.Embedding, err = decodeEmbedding(embedding)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", chunk.ID, err)
+		}
+		chunk.CreatedAt = parseTime(createdAt)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// ReplaceKnowledgeChunks swaps the chunks of every knowledge base entry with the given set.
+// Chunks of entries that no longer exist are removed as well.
+func ReplaceKnowledgeChunks(chunks []KnowledgeChunk) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM kb_chunks")
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		_, err = tx.Exec(`
+			INSERT INTO kb_chunks (knowledge_base_id, chunk_index, content, content_hash, embedding, embedding_model)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, chunk.KnowledgeBaseID, chunk.ChunkIndex, chunk.Content, chunk.ContentHash,
+			encodeEmbedding(chunk.Embedding), chunk.EmbeddingModel)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// encodeEmbedding stores a vector as little-endian float32 values
+func encodeEmbedding(vector []float64) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) ([]float64, error) {
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid embedding length %d", len(buf))
+	}
+
+	vector := make([]float64, len(buf)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+	}
+	return vector, nil
+}
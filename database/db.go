@@ -2,7 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"sync"
+	"telecust/events"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -25,6 +28,10 @@ func InitDB(dbPath string) error {
 		telegram_username TEXT,
 		telegram_first_name TEXT,
 		is_bot_active BOOLEAN DEFAULT 1,
+		assigned_agent TEXT NOT NULL DEFAULT '',
+		takeover_timeout INTEGER,
+		bot_paused_at DATETIME,
+		staff_topic_id INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -35,17 +42,184 @@ func InitDB(dbPath string) error {
 		sender_type TEXT NOT NULL,
 		message_text TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		kb_revision_id INTEGER,
+		model TEXT,
+		prompt_version TEXT,
+		latency_ms INTEGER,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		total_tokens INTEGER,
+		sent_by TEXT NOT NULL DEFAULT '',
 		FOREIGN KEY (conversation_id) REFERENCES conversations(id)
 	);
 
 	CREATE TABLE IF NOT EXISTS knowledge_base (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL DEFAULT 'Knowledge Base',
+		category TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
 		content TEXT NOT NULL,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS kb_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		knowledge_base_id INTEGER NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		embedding_model TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (knowledge_base_id) REFERENCES knowledge_base(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS knowledge_base_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		title TEXT NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		content TEXT NOT NULL,
+		author TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tool_calls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id INTEGER NOT NULL,
+		tool_name TEXT NOT NULL,
+		arguments TEXT NOT NULL,
+		result TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS products (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		aliases TEXT NOT NULL DEFAULT '',
+		unit TEXT NOT NULL DEFAULT 'bungkus',
+		base_price INTEGER NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS product_price_tiers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		min_quantity INTEGER NOT NULL,
+		unit_price INTEGER NOT NULL,
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		total INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS order_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		product_id INTEGER,
+		product_name TEXT NOT NULL,
+		quantity INTEGER NOT NULL,
+		unit TEXT NOT NULL DEFAULT '',
+		unit_price INTEGER NOT NULL,
+		total INTEGER NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER NOT NULL,
+		conversation_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		file_id TEXT NOT NULL,
+		file_unique_id TEXT NOT NULL DEFAULT '',
+		file_name TEXT NOT NULL DEFAULT '',
+		mime_type TEXT NOT NULL DEFAULT '',
+		file_size INTEGER NOT NULL DEFAULT 0,
+		caption TEXT NOT NULL DEFAULT '',
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		duration INTEGER NOT NULL DEFAULT 0,
+		emoji TEXT NOT NULL DEFAULT '',
+		local_path TEXT NOT NULL DEFAULT '',
+		transcript TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (message_id) REFERENCES messages(id),
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS quick_replies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		label TEXT NOT NULL,
+		action TEXT NOT NULL DEFAULT 'message',
+		payload TEXT NOT NULL DEFAULT '',
+		show_on TEXT NOT NULL DEFAULT 'start',
+		position INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS conversation_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		data TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS admin_users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL COLLATE NOCASE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'viewer',
+		telegram_id INTEGER NOT NULL DEFAULT 0,
+		last_login_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		before_data TEXT NOT NULL DEFAULT '',
+		after_data TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		ip TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at);
+	CREATE INDEX IF NOT EXISTS idx_kb_chunks_kb ON kb_chunks(knowledge_base_id);
+	CREATE INDEX IF NOT EXISTS idx_kb_revisions_document ON knowledge_base_revisions(document_id);
+	CREATE INDEX IF NOT EXISTS idx_tool_calls_conversation ON tool_calls(conversation_id);
+	CREATE INDEX IF NOT EXISTS idx_price_tiers_product ON product_price_tiers(product_id);
+	CREATE INDEX IF NOT EXISTS idx_orders_conversation ON orders(conversation_id);
+	CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+	CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(order_id);
+	CREATE INDEX IF NOT EXISTS idx_conversation_events_conversation ON conversation_events(conversation_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
 	`
 
 	_, err = DB.Exec(schema)
@@ -53,6 +227,35 @@ func InitDB(dbPath string) error {
 		return err
 	}
 
+	// Add columns introduced after the first release to existing databases
+	migrations := []struct{ table, column, definition string }{
+		{"knowledge_base", "title", "TEXT NOT NULL DEFAULT 'Knowledge Base'"},
+		{"knowledge_base", "category", "TEXT NOT NULL DEFAULT ''"},
+		{"knowledge_base", "enabled", "BOOLEAN NOT NULL DEFAULT 1"},
+		{"messages", "kb_revision_id", "INTEGER"},
+		{"messages", "model", "TEXT"},
+		{"messages", "prompt_version", "TEXT"},
+		{"messages", "latency_ms", "INTEGER"},
+		{"messages", "prompt_tokens", "INTEGER"},
+		{"messages", "completion_tokens", "INTEGER"},
+		{"messages", "total_tokens", "INTEGER"},
+		{"attachments", "transcript", "TEXT NOT NULL DEFAULT ''"},
+		// Users from before roles existed had full access
+		{"admin_users", "role", "TEXT NOT NULL DEFAULT 'owner'"},
+		{"conversations", "assigned_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "sent_by", "TEXT NOT NULL DEFAULT ''"},
+		{"conversations", "takeover_timeout", "INTEGER"},
+		{"conversations", "bot_paused_at", "DATETIME"},
+		{"conversations", "staff_topic_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"admin_users", "telegram_id", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, m := range migrations {
+		err = addColumnIfMissing(m.table, m.column, m.definition)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Insert default knowledge base if empty
 	var count int
 	err = DB.QueryRow("SELECT COUNT(*) FROM knowledge_base").Scan(&count)
@@ -66,25 +269,118 @@ Pesan diatas 10 harga 4rb.
 Jika pesan 10 Rp40ribu.
 Jika pesan 20 Rp80ribu.
 Jika pesan di atas 100 bungkus harga Rp3ribu.`
-		_, err = DB.Exec("INSERT INTO knowledge_base (content) VALUES (?)", defaultKB)
+		_, err = DB.Exec("INSERT INTO knowledge_base (title, category, content) VALUES (?, ?, ?)", "Harga", "Produk", defaultKB)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Insert the default product matching the default knowledge base if the catalog is empty
+	err = DB.QueryRow("SELECT COUNT(*) FROM products").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err = CreateProduct(&Product{
+			Name:      "Keripik kentang",
+			Aliases:   "kentang, keripik",
+			Unit:      "bungkus",
+			BasePrice: 5000,
+			Enabled:   true,
+			Tiers: []PriceTier{
+				{MinQuantity: 10, UnitPrice: 4000},
+				{MinQuantity: 101, UnitPrice: 3000},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Insert the default quick-reply buttons shown with the welcome message
+	err = DB.QueryRow("SELECT COUNT(*) FROM quick_replies").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		defaults := []QuickReply{
+			{Label: "Lihat harga", Action: QuickReplyMessage, Payload: "Berapa harganya?", ShowOn: ShowOnStart, Position: 1, Enabled: true},
+			{Label: "Pesan sekarang", Action: QuickReplyMessage, Payload: "Saya mau pesan", ShowOn: ShowOnStart, Position: 2, Enabled: true},
+			{Label: "Hubungi admin", Action: QuickReplyHandoff, ShowOn: ShowOnStart, Position: 3, Enabled: true},
+		}
+		for i := range defaults {
+			err = CreateQuickReply(&defaults[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Give documents that predate revision history an initial revision to roll back to
+	err = seedKnowledgeRevisions()
+	if err != nil {
+		return err
+	}
+
 	log.Println("Database initialized successfully")
 	return nil
 }
 
-// GetOrCreateConversation finds or creates a conversation for a Telegram chat
-func GetOrCreateConversation(chatID int64, username, firstName string) (*Conversation, error) {
+// addColumnIfMissing adds a column to a table created by an older version of the schema
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Adding column %s.%s", table, column)
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// parseTime parses a SQLite datetime, which the driver returns either as
+// "2006-01-02 15:04:05" or RFC 3339 depending on the column type
+func parseTime(value string) time.Time {
+	if t, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+		return t
+	}
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+// GetOrCreateConversation finds or creates a conversation for a Telegram chat and
+// reports whether it was created
+func GetOrCreateConversation(chatID int64, username, firstName string) (*Conversation, bool, error) {
 	var conv Conversation
 	var createdAt, updatedAt string
+	var takeoverTimeout sql.NullInt64
+	var botPausedAt sql.NullString
 
 	err := DB.QueryRow(`
-		SELECT id, telegram_chat_id, telegram_username, telegram_first_name, is_bot_active, created_at, updated_at
+		SELECT id, telegram_chat_id, telegram_username, telegram_first_name, is_bot_active, assigned_agent,
+		       takeover_timeout, bot_paused_at, created_at, updated_at
 		FROM conversations WHERE telegram_chat_id = ?
-	`, chatID).Scan(&conv.ID, &conv.TelegramChatID, &conv.TelegramUsername, &conv.TelegramFirstName, &conv.IsBotActive, &createdAt, &updatedAt)
+	`, chatID).Scan(&conv.ID, &conv.TelegramChatID, &conv.TelegramUsername, &conv.TelegramFirstName, &conv.IsBotActive, &conv.AssignedAgent,
+		&takeoverTimeout, &botPausedAt, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
 		// Create new conversation
@@ -93,7 +389,7 @@ func GetOrCreateConversation(chatID int64, username, firstName string) (*Convers
 			VALUES (?, ?, ?)
 		`, chatID, username, firstName)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		id, _ := result.LastInsertId()
@@ -104,44 +400,130 @@ func GetOrCreateConversation(chatID int64, username, firstName string) (*Convers
 		conv.IsBotActive = true
 		conv.CreatedAt = time.Now()
 		conv.UpdatedAt = time.Now()
-		return &conv, nil
+		return &conv, true, nil
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Parse datetime strings
-	conv.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-	conv.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	conv.CreatedAt = parseTime(createdAt)
+	conv.UpdatedAt = parseTime(updatedAt)
+	setTakeoverFields(&conv, takeoverTimeout, botPausedAt)
 
-	return &conv, nil
+	return &conv, false, nil
+}
+
+// setTakeoverFields copies the nullable takeover columns onto a conversation
+func setTakeoverFields(conv *Conversation, takeoverTimeout sql.NullInt64, botPausedAt sql.NullString) {
+	if takeoverTimeout.Valid {
+		minutes := int(takeoverTimeout.Int64)
+		conv.TakeoverTimeout = &minutes
+	}
+	if botPausedAt.Valid {
+		pausedAt := parseTime(botPausedAt.String)
+		conv.BotPausedAt = &pausedAt
+	}
 }
 
 // SaveMessage saves a message to the database
 func SaveMessage(conversationID int, senderType, messageText string) error {
-	_, err := DB.Exec(`
-		INSERT INTO messages (conversation_id, sender_type, message_text)
-		VALUES (?, ?, ?)
-	`, conversationID, senderType, messageText)
+	return SaveMessageWithAudit(conversationID, senderType, messageText, nil)
+}
+
+// SaveMessageWithAudit saves a message together with the details of how it was generated
+func SaveMessageWithAudit(conversationID int, senderType, messageText string, audit *MessageAudit) error {
+	id, err := insertMessage(DB, conversationID, senderType, "", messageText, audit)
+	if err != nil {
+		return err
+	}
+
+	publishMessage(&Message{ID: id, ConversationID: conversationID, SenderType: senderType, MessageText: messageText, Audit: audit})
+	return nil
+}
 
+// SaveAdminMessage saves a message a dashboard user sent to the customer
+func SaveAdminMessage(conversationID int, sentBy, messageText string) error {
+	id, err := insertMessage(DB, conversationID, "admin", sentBy, messageText, nil)
 	if err != nil {
 		return err
 	}
 
+	publishMessage(&Message{ID: id, ConversationID: conversationID, SenderType: "admin", SentBy: sentBy, MessageText: messageText})
+	return nil
+}
+
+var (
+	messageHooksMu sync.RWMutex
+	messageHooks   []func(msg *Message)
+)
+
+// OnMessageSaved registers fn to be called with every message once it is stored, in
+// the order messages are saved. Unlike the event bus it never skips a message, so fn
+// must return quickly and hand slow work to another goroutine.
+func OnMessageSaved(fn func(msg *Message)) {
+	messageHooksMu.Lock()
+	defer messageHooksMu.Unlock()
+	messageHooks = append(messageHooks, fn)
+}
+
+// publishMessage passes a stored message to the OnMessageSaved hooks and tells
+// connected dashboards about it
+func publishMessage(msg *Message) {
+	msg.CreatedAt = time.Now()
+
+	messageHooksMu.RLock()
+	for _, fn := range messageHooks {
+		fn(msg)
+	}
+	messageHooksMu.RUnlock()
+
+	events.Publish(events.Event{Type: events.MessageCreated, ConversationID: msg.ConversationID, Data: msg})
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertMessage stores a message, bumps the conversation's updated_at and returns the message ID
+func insertMessage(db execer, conversationID int, senderType, sentBy, messageText string, audit *MessageAudit) (int, error) {
+	var result sql.Result
+	var err error
+	if audit != nil {
+		result, err = db.Exec(`
+			INSERT INTO messages (conversation_id, sender_type, message_text,
+				kb_revision_id, model, prompt_version, latency_ms, prompt_tokens, completion_tokens, total_tokens)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, conversationID, senderType, messageText, audit.KBRevisionID, audit.Model, audit.PromptVersion,
+			audit.LatencyMs, audit.PromptTokens, audit.CompletionTokens, audit.TotalTokens)
+	} else {
+		result, err = db.Exec(`
+			INSERT INTO messages (conversation_id, sender_type, sent_by, message_text)
+			VALUES (?, ?, ?, ?)
+		`, conversationID, senderType, sentBy, messageText)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+
 	// Update conversation updated_at
-	_, err = DB.Exec(`
+	_, err = db.Exec(`
 		UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?
 	`, conversationID)
 
-	return err
+	return int(id), err
 }
 
 // GetAllConversations returns all conversations with their last message
 func GetAllConversations() ([]Conversation, error) {
 	rows, err := DB.Query(`
 		SELECT c.id, c.telegram_chat_id, c.telegram_username, c.telegram_first_name,
-		       c.is_bot_active, c.created_at, c.updated_at,
+		       c.is_bot_active, c.assigned_agent, c.takeover_timeout, c.bot_paused_at, c.created_at, c.updated_at,
 		       COALESCE(m.message_text, '') as last_message,
 		       COALESCE(m.created_at, c.created_at) as last_message_time
 		FROM conversations c
@@ -165,17 +547,21 @@ func GetAllConversations() ([]Conversation, error) {
 	for rows.Next() {
 		var conv Conversation
 		var createdAt, updatedAt, lastMessageTime string
+		var takeoverTimeout sql.NullInt64
+		var botPausedAt sql.NullString
 
 		err := rows.Scan(&conv.ID, &conv.TelegramChatID, &conv.TelegramUsername, &conv.TelegramFirstName,
-			&conv.IsBotActive, &createdAt, &updatedAt, &conv.LastMessage, &lastMessageTime)
+			&conv.IsBotActive, &conv.AssignedAgent, &takeoverTimeout, &botPausedAt, &createdAt, &updatedAt,
+			&conv.LastMessage, &lastMessageTime)
 		if err != nil {
 			return nil, err
 		}
 
 		// Parse datetime strings
-		conv.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		conv.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
-		conv.LastMessageTime, _ = time.Parse("2006-01-02 15:04:05", lastMessageTime)
+		conv.CreatedAt = parseTime(createdAt)
+		conv.UpdatedAt = parseTime(updatedAt)
+		conv.LastMessageTime = parseTime(lastMessageTime)
+		setTakeoverFields(&conv, takeoverTimeout, botPausedAt)
 
 		conversations = append(conversations, conv)
 	}
@@ -183,44 +569,74 @@ func GetAllConversations() ([]Conversation, error) {
 	return conversations, nil
 }
 
-// GetMessages returns all messages for a conversation
-func GetMessages(conversationID int) ([]Message, error) {
-	rows, err := DB.Query(`
-		SELECT id, conversation_id, sender_type, message_text, created_at
-		FROM messages
-		WHERE conversation_id = ?
-		ORDER BY created_at ASC
-	`, conversationID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+const messageColumns = `id, conversation_id, sender_type, sent_by, message_text, created_at,
+	kb_revision_id, model, prompt_version, latency_ms, prompt_tokens, completion_tokens, total_tokens`
 
+// scanMessages reads message rows selected with messageColumns
+func scanMessages(rows *sql.Rows) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
 		var createdAt string
+		var kbRevisionID, latencyMs, promptTokens, completionTokens, totalTokens sql.NullInt64
+		var model, promptVersion sql.NullString
 
-		err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderType, &msg.MessageText, &createdAt)
+		err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderType, &msg.SentBy, &msg.MessageText, &createdAt,
+			&kbRevisionID, &model, &promptVersion, &latencyMs, &promptTokens, &completionTokens, &totalTokens)
 		if err != nil {
 			return nil, err
 		}
 
 		// Parse datetime string
-		msg.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		msg.CreatedAt = parseTime(createdAt)
+
+		if promptVersion.Valid {
+			msg.Audit = &MessageAudit{
+				KBRevisionID:     int(kbRevisionID.Int64),
+				Model:            model.String,
+				PromptVersion:    promptVersion.String,
+				LatencyMs:        latencyMs.Int64,
+				PromptTokens:     int(promptTokens.Int64),
+				CompletionTokens: int(completionTokens.Int64),
+				TotalTokens:      int(totalTokens.Int64),
+			}
+		}
+
 		messages = append(messages, msg)
 	}
 
-	return messages, nil
+	return messages, rows.Err()
+}
+
+// GetMessages returns all messages for a conversation
+func GetMessages(conversationID int) ([]Message, error) {
+	rows, err := DB.Query(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE conversation_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadMessageAttachments(messages)
+	return messages, err
 }
 
 // GetRecentMessages returns the most recent N messages for a conversation
 func GetRecentMessages(conversationID int, limit int) ([]Message, error) {
 	rows, err := DB.Query(`
-		SELECT id, conversation_id, sender_type, message_text, created_at
+		SELECT `+messageColumns+`
 		FROM messages
 		WHERE conversation_id = ?
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT ?
 	`, conversationID, limit)
 	if err != nil {
@@ -228,19 +644,9 @@ func GetRecentMessages(conversationID int, limit int) ([]Message, error) {
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		var createdAt string
-
-		err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderType, &msg.MessageText, &createdAt)
-		if err != nil {
-			return nil, err
-		}
-
-		// Parse datetime string
-		msg.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		messages = append(messages, msg)
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
 	}
 
 	// Reverse the slice to get chronological order (oldest first)
@@ -248,30 +654,211 @@ func GetRecentMessages(conversationID int, limit int) ([]Message, error) {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
-	return messages, nil
+	err = loadMessageAttachments(messages)
+	return messages, err
+}
+
+// GetConversation returns a conversation by ID, or nil if it does not exist
+func GetConversation(id int) (*Conversation, error) {
+	var conv Conversation
+	var createdAt, updatedAt string
+	var takeoverTimeout sql.NullInt64
+	var botPausedAt sql.NullString
+
+	err := DB.QueryRow(`
+		SELECT id, telegram_chat_id, telegram_username, telegram_first_name, is_bot_active, assigned_agent,
+		       takeover_timeout, bot_paused_at, created_at, updated_at
+		FROM conversations WHERE id = ?
+	`, id).Scan(&conv.ID, &conv.TelegramChatID, &conv.TelegramUsername, &conv.TelegramFirstName,
+		&conv.IsBotActive, &conv.AssignedAgent, &takeoverTimeout, &botPausedAt, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conv.CreatedAt = parseTime(createdAt)
+	conv.UpdatedAt = parseTime(updatedAt)
+	setTakeoverFields(&conv, takeoverTimeout, botPausedAt)
+	return &conv, nil
+}
+
+// ClaimConversation assigns a conversation to an agent unless another agent already
+// has it. It reports whether the agent now holds the conversation.
+func ClaimConversation(conversationID int, agent string) (bool, error) {
+	result, err := DB.Exec(`
+		UPDATE conversations SET assigned_agent = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (assigned_agent = '' OR assigned_agent = ?)
+	`, agent, conversationID, agent)
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		publishAssignment(conversationID, agent)
+	}
+	return n > 0, nil
+}
+
+// AssignConversation sets the agent handling a conversation; an empty agent releases it
+func AssignConversation(conversationID int, agent string) error {
+	_, err := DB.Exec(`
+		UPDATE conversations SET assigned_agent = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, agent, conversationID)
+	if err != nil {
+		return err
+	}
+
+	publishAssignment(conversationID, agent)
+	return nil
 }
 
-// SetBotActive sets the is_bot_active flag for a conversation
+// ReleaseAgentConversations unassigns every conversation held by an agent
+func ReleaseAgentConversations(agent string) error {
+	_, err := DB.Exec(`
+		UPDATE conversations SET assigned_agent = '', updated_at = CURRENT_TIMESTAMP
+		WHERE assigned_agent = ? COLLATE NOCASE
+	`, agent)
+	return err
+}
+
+func publishAssignment(conversationID int, agent string) {
+	events.Publish(events.Event{
+		Type:           events.AssignmentChanged,
+		ConversationID: conversationID,
+		Data:           map[string]string{"assigned_agent": agent},
+	})
+}
+
+// SetBotActive sets the is_bot_active flag for a conversation. Pausing the bot
+// records when, so the takeover timeout can resume it later.
 func SetBotActive(conversationID int, active bool) error {
 	_, err := DB.Exec(`
-		UPDATE conversations SET is_bot_active = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE conversations SET is_bot_active = ?,
+			bot_paused_at = CASE WHEN ? THEN NULL ELSE CURRENT_TIMESTAMP END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, active, active, conversationID)
+	if err != nil {
+		return err
+	}
+
+	events.Publish(events.Event{
+		Type:           events.BotActiveChanged,
+		ConversationID: conversationID,
+		Data:           map[string]bool{"is_bot_active": active},
+	})
+	return nil
+}
+
+// SetTakeoverTimeout sets how many minutes without an admin message resume the bot in a
+// conversation. nil uses the default, 0 never resumes it.
+func SetTakeoverTimeout(conversationID int, minutes *int) error {
+	_, err := DB.Exec(`
+		UPDATE conversations SET takeover_timeout = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, active, conversationID)
+	`, minutes, conversationID)
 	return err
 }
 
-// GetKnowledgeBase returns the current knowledge base content
+// GetStaffTopic returns the staff forum topic mirroring a conversation, 0 if it has none
+func GetStaffTopic(conversationID int) (int, error) {
+	var topicID int
+	err := DB.QueryRow("SELECT staff_topic_id FROM conversations WHERE id = ?", conversationID).Scan(&topicID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return topicID, err
+}
+
+// SetStaffTopic records the staff forum topic mirroring a conversation; 0 forgets it
+func SetStaffTopic(conversationID, topicID int) error {
+	_, err := DB.Exec("UPDATE conversations SET staff_topic_id = ? WHERE id = ?", topicID, conversationID)
+	return err
+}
+
+// GetConversationByStaffTopic returns the conversation mirrored in a staff forum topic,
+// or nil if the topic belongs to none
+func GetConversationByStaffTopic(topicID int) (*Conversation, error) {
+	var id int
+	err := DB.QueryRow("SELECT id FROM conversations WHERE staff_topic_id = ? AND staff_topic_id != 0", topicID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetConversation(id)
+}
+
+// GetIdleTakeovers returns conversations whose bot has been paused with no admin
+// message for longer than their takeover timeout, or defaultMinutes if they have
+// none. A timeout of 0 never expires.
+func GetIdleTakeovers(defaultMinutes int) ([]Conversation, error) {
+	// Paused conversations from before bot_paused_at existed fall back to updated_at
+	rows, err := DB.Query(`
+		SELECT id
+		FROM conversations c
+		WHERE is_bot_active = 0 AND COALESCE(takeover_timeout, ?) > 0
+		  AND datetime(MAX(
+		        COALESCE(bot_paused_at, updated_at),
+		        COALESCE((SELECT MAX(created_at) FROM messages WHERE conversation_id = c.id AND sender_type = 'admin'), '')
+		      ), '+' || COALESCE(takeover_timeout, ?) || ' minutes') <= datetime('now')
+	`, defaultMinutes, defaultMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var conversations []Conversation
+	for _, id := range ids {
+		conv, err := GetConversation(id)
+		if err != nil {
+			return nil, err
+		}
+		if conv != nil {
+			conversations = append(conversations, *conv)
+		}
+	}
+	return conversations, nil
+}
+
+// GetKnowledgeBase returns the content of the most recent knowledge base document
 func GetKnowledgeBase() (string, error) {
 	var content string
 	err := DB.QueryRow("SELECT content FROM knowledge_base ORDER BY id DESC LIMIT 1").Scan(&content)
 	return content, err
 }
 
-// UpdateKnowledgeBase updates the knowledge base content
-func UpdateKnowledgeBase(content string) error {
-	_, err := DB.Exec(`
-		UPDATE knowledge_base SET content = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = (SELECT id FROM knowledge_base ORDER BY id DESC LIMIT 1)
-	`, content)
-	return err
+// UpdateKnowledgeBase updates the content of the most recent knowledge base document
+func UpdateKnowledgeBase(content, author string) error {
+	var id int
+	err := DB.QueryRow("SELECT id FROM knowledge_base ORDER BY id DESC LIMIT 1").Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	doc, err := GetKnowledgeDocument(id)
+	if err != nil {
+		return err
+	}
+
+	doc.Content = content
+	return UpdateKnowledgeDocument(doc, author)
 }
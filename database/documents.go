@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+const documentColumns = "id, title, category, enabled, content, updated_at"
+
+func scanDocument(row interface{ Scan(...interface{}) error }) (*KnowledgeBase, error) {
+	var doc KnowledgeBase
+	var updatedAt string
+
+	err := row.Scan(&doc.ID, &doc.Title, &doc.Category, &doc.Enabled, &doc.Content, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.UpdatedAt = parseTime(updatedAt)
+	return &doc, nil
+}
+
+func queryDocuments(query string, args ...interface{}) ([]KnowledgeBase, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []KnowledgeBase
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+
+	return docs, rows.Err()
+}
+
+// ListKnowledgeDocuments returns all knowledge base documents, grouped by category
+func ListKnowledgeDocuments() ([]KnowledgeBase, error) {
+	return queryDocuments("SELECT " + documentColumns + " FROM knowledge_base ORDER BY category ASC, title ASC, id ASC")
+}
+
+// GetKnowledgeBaseEntries returns the enabled knowledge base documents the bot answers from
+func GetKnowledgeBaseEntries() ([]KnowledgeBase, error) {
+	return queryDocuments("SELECT " + documentColumns + " FROM knowledge_base WHERE enabled = 1 ORDER BY category ASC, title ASC, id ASC")
+}
+
+// GetKnowledgeDocument returns a single document, or nil if it does not exist
+func GetKnowledgeDocument(id int) (*KnowledgeBase, error) {
+	doc, err := scanDocument(DB.QueryRow("SELECT "+documentColumns+" FROM knowledge_base WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return doc, err
+}
+
+// CreateKnowledgeDocument inserts a new document, sets its ID and records the first revision
+func CreateKnowledgeDocument(doc *KnowledgeBase, author string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO knowledge_base (title, category, enabled, content)
+		VALUES (?, ?, ?, ?)
+	`, doc.Title, doc.Category, doc.Enabled, doc.Content)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	doc.ID = int(id)
+
+	err = recordRevision(tx, doc, RevisionCreate, author)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateKnowledgeDocument saves all editable fields of a document and records a revision
+func UpdateKnowledgeDocument(doc *KnowledgeBase, author string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE knowledge_base SET title = ?, category = ?, enabled = ?, content = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, doc.Title, doc.Category, doc.Enabled, doc.Content, doc.ID)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(tx, doc, RevisionUpdate, author)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteKnowledgeDocument removes a document and its retrieval chunks. The deletion is
+// recorded as a revision so the document can be restored later.
+func DeleteKnowledgeDocument(doc *KnowledgeBase, author string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM kb_chunks WHERE knowledge_base_id = ?", doc.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM knowledge_base WHERE id = ?", doc.ID)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(tx, doc, RevisionDelete, author)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetKnowledgeBaseContext composes the text of all enabled documents, each under its title
+func GetKnowledgeBaseContext() (string, error) {
+	docs, err := GetKnowledgeBaseEntries()
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, doc := range docs {
+		parts = append(parts, FormatKnowledgeDocument(doc.Title, doc.Content))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// FormatKnowledgeDocument prefixes document text with its title so the AI knows where it came from
+func FormatKnowledgeDocument(title, content string) string {
+	content = strings.TrimSpace(content)
+	if title == "" {
+		return content
+	}
+	return "### " + title + "\n" + content
+}
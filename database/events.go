@@ -0,0 +1,54 @@
+package database
+
+import (
+	"telecust/events"
+	"time"
+)
+
+// SaveConversationEvent records an event in a conversation
+func SaveConversationEvent(event *ConversationEvent) error {
+	result, err := DB.Exec(`
+		INSERT INTO conversation_events (conversation_id, event_type, label, data)
+		VALUES (?, ?, ?, ?)
+	`, event.ConversationID, event.Type, event.Label, event.Data)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	event.ID = int(id)
+	event.CreatedAt = time.Now()
+
+	events.Publish(events.Event{Type: events.ConversationEvent, ConversationID: event.ConversationID, Data: event})
+	return nil
+}
+
+// GetConversationEvents returns the events of a conversation, oldest first
+func GetConversationEvents(conversationID int) ([]ConversationEvent, error) {
+	rows, err := DB.Query(`
+		SELECT id, conversation_id, event_type, label, data, created_at
+		FROM conversation_events
+		WHERE conversation_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ConversationEvent
+	for rows.Next() {
+		var event ConversationEvent
+		var createdAt string
+
+		err := rows.Scan(&event.ID, &event.ConversationID, &event.Type, &event.Label, &event.Data, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		event.CreatedAt = parseTime(createdAt)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
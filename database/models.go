@@ -3,27 +3,271 @@ package database
 import "time"
 
 type Conversation struct {
-	ID               int       `json:"id"`
-	TelegramChatID   int64     `json:"telegram_chat_id"`
-	TelegramUsername string    `json:"telegram_username"`
-	TelegramFirstName string   `json:"telegram_first_name"`
-	IsBotActive      bool      `json:"is_bot_active"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	LastMessage      string    `json:"last_message,omitempty"`
-	LastMessageTime  time.Time `json:"last_message_time,omitempty"`
+	ID                int        `json:"id"`
+	TelegramChatID    int64      `json:"telegram_chat_id"`
+	TelegramUsername  string     `json:"telegram_username"`
+	TelegramFirstName string     `json:"telegram_first_name"`
+	IsBotActive       bool       `json:"is_bot_active"`
+	AssignedAgent     string     `json:"assigned_agent"`   // Username of the agent handling the chat, empty if unassigned
+	TakeoverTimeout   *int       `json:"takeover_timeout"` // Idle minutes before the bot resumes; nil uses the default, 0 never
+	BotPausedAt       *time.Time `json:"bot_paused_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	LastMessage       string     `json:"last_message,omitempty"`
+	LastMessageTime   time.Time  `json:"last_message_time,omitempty"`
 }
 
 type Message struct {
-	ID             int       `json:"id"`
-	ConversationID int       `json:"conversation_id"`
-	SenderType     string    `json:"sender_type"` // 'user', 'bot', 'admin'
-	MessageText    string    `json:"message_text"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID             int           `json:"id"`
+	ConversationID int           `json:"conversation_id"`
+	SenderType     string        `json:"sender_type"`       // 'user', 'bot', 'admin'
+	SentBy         string        `json:"sent_by,omitempty"` // Dashboard user who sent an admin message
+	MessageText    string        `json:"message_text"`      // The caption for messages with attachments
+	CreatedAt      time.Time     `json:"created_at"`
+	Audit          *MessageAudit `json:"audit,omitempty"` // Only set for bot replies
+	Attachments    []Attachment  `json:"attachments,omitempty"`
 }
 
+// MessageAudit records what produced a bot reply, so wrong answers can be traced back
+type MessageAudit struct {
+	KBRevisionID     int    `json:"kb_revision_id"` // Newest knowledge base revision when the reply was generated
+	Model            string `json:"model"`
+	PromptVersion    string `json:"prompt_version"`
+	LatencyMs        int64  `json:"latency_ms"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+}
+
+// KnowledgeBase is one knowledge base document
 type KnowledgeBase struct {
 	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Category  string    `json:"category"`
+	Enabled   bool      `json:"enabled"`
 	Content   string    `json:"content"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// KnowledgeChunk is a piece of a knowledge base entry with its embedding vector
+type KnowledgeChunk struct {
+	ID              int       `json:"id"`
+	KnowledgeBaseID int       `json:"knowledge_base_id"`
+	ChunkIndex      int       `json:"chunk_index"`
+	Content         string    `json:"content"`
+	ContentHash     string    `json:"content_hash"`
+	Embedding       []float64 `json:"-"`
+	EmbeddingModel  string    `json:"embedding_model"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// KnowledgeRevision is a snapshot of a knowledge base document after a change
+type KnowledgeRevision struct {
+	ID         int       `json:"id"`
+	DocumentID int       `json:"document_id"`
+	Action     string    `json:"action"` // 'create', 'update', 'delete', 'restore'
+	Title      string    `json:"title"`
+	Category   string    `json:"category"`
+	Enabled    bool      `json:"enabled"`
+	Content    string    `json:"content"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ToolCallLog records a tool the AI called while answering a customer
+type ToolCallLog struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	ToolName       string    `json:"tool_name"`
+	Arguments      string    `json:"arguments"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Product is a catalog item with tiered pricing. Prices are whole Rupiah.
+type Product struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	Aliases   string      `json:"aliases"` // Comma-separated names customers may use
+	Unit      string      `json:"unit"`
+	BasePrice int64       `json:"base_price"` // Unit price when no tier applies
+	Enabled   bool        `json:"enabled"`
+	Tiers     []PriceTier `json:"tiers"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// PriceTier sets the unit price for orders of at least MinQuantity units
+type PriceTier struct {
+	MinQuantity int   `json:"min_quantity"`
+	UnitPrice   int64 `json:"unit_price"`
+}
+
+// PriceQuote is the result of pricing a quantity of a product
+type PriceQuote struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Unit        string `json:"unit"`
+	UnitPrice   int64  `json:"unit_price"`
+	Total       int64  `json:"total"`
+	TierMinimum int    `json:"tier_min_quantity"` // 0 when the base price applies
+}
+
+// Order statuses. A pending order waits for the customer to confirm it in Telegram.
+const (
+	OrderPending   = "pending"
+	OrderConfirmed = "confirmed"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+)
+
+// Order is an order a customer placed in a conversation, priced from the product catalog
+type Order struct {
+	ID                int         `json:"id"`
+	ConversationID    int         `json:"conversation_id"`
+	Status            string      `json:"status"` // 'pending', 'confirmed', 'completed', 'cancelled'
+	Total             int64       `json:"total"`
+	Notes             string      `json:"notes"`
+	Items             []OrderItem `json:"items"`
+	TelegramUsername  string      `json:"telegram_username"`
+	TelegramFirstName string      `json:"telegram_first_name"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+// OrderItem is one product line of an order. Name and prices are copied from the
+// catalog when the order is created so later price changes do not alter it.
+type OrderItem struct {
+	ID          int    `json:"id"`
+	OrderID     int    `json:"order_id"`
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Unit        string `json:"unit"`
+	UnitPrice   int64  `json:"unit_price"`
+	Total       int64  `json:"total"`
+}
+
+// Quick-reply actions: send the payload as if the customer typed it, hand the chat
+// to an admin, or open the payload URL
+const (
+	QuickReplyMessage = "message"
+	QuickReplyHandoff = "handoff"
+	QuickReplyURL     = "url"
+)
+
+// Where a quick-reply button is shown: with the welcome and greeting replies, or under every bot reply
+const (
+	ShowOnStart  = "start"
+	ShowOnAlways = "always"
+)
+
+// QuickReply is an inline button attached to bot messages
+type QuickReply struct {
+	ID        int       `json:"id"`
+	Label     string    `json:"label"`
+	Action    string    `json:"action"`  // 'message', 'handoff', 'url'
+	Payload   string    `json:"payload"` // Message text for 'message', link for 'url'
+	ShowOn    string    `json:"show_on"` // 'start', 'always'
+	Position  int       `json:"position"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation event types
+const (
+	EventButtonPress = "button_press"
+	EventHandoff     = "handoff"     // The bot handed the conversation to a human; Data holds the trigger
+	EventBotResumed  = "bot_resumed" // The takeover timeout re-enabled the bot; Data holds the minutes
+)
+
+// ConversationEvent is something that happened in a conversation other than a message,
+// such as the customer pressing an inline button
+type ConversationEvent struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	Type           string    `json:"type"`
+	Label          string    `json:"label"` // Human-readable description, e.g. the button text
+	Data           string    `json:"data"`  // Machine-readable detail, e.g. the callback data
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Attachment kinds
+const (
+	AttachmentPhoto    = "photo"
+	AttachmentDocument = "document"
+	AttachmentVoice    = "voice"
+	AttachmentAudio    = "audio"
+	AttachmentVideo    = "video"
+	AttachmentSticker  = "sticker"
+)
+
+// Attachment is a file sent with a message. Files stay on Telegram's servers and are
+// downloaded to local storage the first time someone opens them.
+type Attachment struct {
+	ID             int       `json:"id"`
+	MessageID      int       `json:"message_id"`
+	ConversationID int       `json:"conversation_id"`
+	Kind           string    `json:"kind"` // 'photo', 'document', 'voice', 'audio', 'video', 'sticker'
+	FileID         string    `json:"file_id"`
+	FileUniqueID   string    `json:"file_unique_id"`
+	FileName       string    `json:"file_name"`
+	MimeType       string    `json:"mime_type"`
+	FileSize       int64     `json:"file_size"`
+	Caption        string    `json:"caption"`
+	Width          int       `json:"width,omitempty"`
+	Height         int       `json:"height,omitempty"`
+	Duration       int       `json:"duration,omitempty"`   // Seconds, for voice, audio and video
+	Emoji          string    `json:"emoji,omitempty"`      // Stickers only
+	Transcript     string    `json:"transcript,omitempty"` // Speech-to-text of voice and audio
+	LocalPath      string    `json:"-"`
+	Downloaded     bool      `json:"downloaded"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Dashboard roles, from least to most access
+const (
+	RoleViewer = "viewer" // Reads transcripts, orders and settings
+	RoleAgent  = "agent"  // Also replies to customers, takes over chats and updates orders
+	RoleOwner  = "owner"  // Also changes the knowledge base, catalog, buttons and users
+)
+
+// AdminUser is a dashboard login
+type AdminUser struct {
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`                  // 'owner', 'agent' or 'viewer'
+	TelegramID   int64      `json:"telegram_id,omitempty"` // Telegram user acting for this user in staff chats, 0 = none
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// AuditEntry records a change made through the dashboard API
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	Actor      string    `json:"actor"`       // Username of the dashboard user
+	Action     string    `json:"action"`      // e.g. 'conversation.takeover'
+	TargetType string    `json:"target_type"` // e.g. 'conversation', 'document'
+	TargetID   string    `json:"target_id"`
+	Before     string    `json:"before,omitempty"` // JSON of the target before the change
+	After      string    `json:"after,omitempty"`  // JSON of the target after the change
+	Status     int       `json:"status"`           // HTTP status of the response
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditFilter narrows ListAuditEntries. Empty fields match everything.
+type AuditFilter struct {
+	Actor      string
+	Action     string // Exact action, or a prefix ending in '.' such as 'document.'
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
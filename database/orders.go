@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MaxOrderItems is the most lines one order may have
+const MaxOrderItems = 50
+
+// ValidOrderStatus reports whether status is one of the known order statuses
+func ValidOrderStatus(status string) bool {
+	switch status {
+	case OrderPending, OrderConfirmed, OrderCompleted, OrderCancelled:
+		return true
+	}
+	return false
+}
+
+const orderColumns = `o.id, o.conversation_id, o.status, o.total, o.notes, o.created_at, o.updated_at,
+	COALESCE(c.telegram_username, ''), COALESCE(c.telegram_first_name, '')`
+
+func scanOrder(row interface{ Scan(...interface{}) error }) (*Order, error) {
+	var o Order
+	var createdAt, updatedAt string
+
+	err := row.Scan(&o.ID, &o.ConversationID, &o.Status, &o.Total, &o.Notes, &createdAt, &updatedAt,
+		&o.TelegramUsername, &o.TelegramFirstName)
+	if err != nil {
+		return nil, err
+	}
+
+	o.CreatedAt = parseTime(createdAt)
+	o.UpdatedAt = parseTime(updatedAt)
+	o.Items = []OrderItem{}
+	return &o, nil
+}
+
+// loadOrderItems fills in the items of the given orders
+func loadOrderItems(orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Order)
+	placeholders := make([]string, len(orders))
+	args := make([]interface{}, len(orders))
+	for i, o := range orders {
+		byID[o.ID] = o
+		placeholders[i] = "?"
+		args[i] = o.ID
+	}
+
+	rows, err := DB.Query(`
+		SELECT id, order_id, COALESCE(product_id, 0), product_name, quantity, unit, unit_price, total
+		FROM order_items
+		WHERE order_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName,
+			&item.Quantity, &item.Unit, &item.UnitPrice, &item.Total)
+		if err != nil {
+			return err
+		}
+		if o, ok := byID[item.OrderID]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListOrders returns orders newest first, optionally filtered by status and conversation
+// (empty status or zero conversation ID means no filter)
+func ListOrders(status string, conversationID int) ([]Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders o LEFT JOIN conversations c ON c.id = o.conversation_id WHERE 1 = 1"
+	var args []interface{}
+	if status != "" {
+		query += " AND o.status = ?"
+		args = append(args, status)
+	}
+	if conversationID != 0 {
+		query += " AND o.conversation_id = ?"
+		args = append(args, conversationID)
+	}
+	query += " ORDER BY o.created_at DESC, o.id DESC"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadOrderItems(orders)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Order, len(orders))
+	for i, o := range orders {
+		result[i] = *o
+	}
+	return result, nil
+}
+
+// GetOrder returns an order with its items, or nil if it does not exist
+func GetOrder(id int) (*Order, error) {
+	o, err := scanOrder(DB.QueryRow("SELECT "+orderColumns+" FROM orders o LEFT JOIN conversations c ON c.id = o.conversation_id WHERE o.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadOrderItems([]*Order{o})
+	return o, err
+}
+
+// CreateOrder stores a new pending order with its items and sets its ID and total.
+// Older pending orders of the same conversation are cancelled, since the customer
+// can only confirm the latest one.
+func CreateOrder(o *Order) error {
+	if len(o.Items) == 0 {
+		return fmt.Errorf("order has no items")
+	}
+	if len(o.Items) > MaxOrderItems {
+		return fmt.Errorf("order has more than %d items", MaxOrderItems)
+	}
+
+	var total int64
+	for _, item := range o.Items {
+		if item.Quantity <= 0 || item.Quantity > MaxQuantity {
+			return fmt.Errorf("quantity of %s must be between 1 and %d", item.ProductName, MaxQuantity)
+		}
+		if item.Total <= 0 || total > math.MaxInt64-item.Total {
+			return fmt.Errorf("total of %s is out of range", item.ProductName)
+		}
+		total += item.Total
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE conversation_id = ? AND status = ?
+	`, OrderCancelled, o.ConversationID, OrderPending)
+	if err != nil {
+		return err
+	}
+
+	o.Status = OrderPending
+	o.Total = total
+
+	result, err := tx.Exec(`
+		INSERT INTO orders (conversation_id, status, total, notes)
+		VALUES (?, ?, ?, ?)
+	`, o.ConversationID, o.Status, o.Total, o.Notes)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	o.ID = int(id)
+
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.OrderID = o.ID
+
+		var productID interface{}
+		if item.ProductID != 0 {
+			productID = item.ProductID
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO order_items (order_id, product_id, product_name, quantity, unit, unit_price, total)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, o.ID, productID, item.ProductName, item.Quantity, item.Unit, item.UnitPrice, item.Total)
+		if err != nil {
+			return err
+		}
+
+		itemID, _ := result.LastInsertId()
+		item.ID = int(itemID)
+	}
+
+	return tx.Commit()
+}
+
+// SetOrderStatus changes the status of an order
+func SetOrderStatus(id int, status string) error {
+	if !ValidOrderStatus(status) {
+		return fmt.Errorf("invalid order status %q", status)
+	}
+
+	_, err := DB.Exec(`
+		UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, status, id)
+	return err
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Bounds on quantities and prices. Any real order is far below them, and they keep
+// every line total well inside int64.
+const (
+	MaxQuantity  = 1_000_000
+	MaxUnitPrice = 1_000_000_000 // Rupiah
+)
+
+// Quote prices a quantity of the product. The tier with the highest minimum
+// quantity not above the ordered quantity sets the unit price for all units.
+func (p *Product) Quote(quantity int) (PriceQuote, error) {
+	if quantity <= 0 || quantity > MaxQuantity {
+		return PriceQuote{}, fmt.Errorf("quantity must be between 1 and %d", MaxQuantity)
+	}
+
+	quote := PriceQuote{
+		ProductID:   p.ID,
+		ProductName: p.Name,
+		Quantity:    quantity,
+		Unit:        p.Unit,
+		UnitPrice:   p.BasePrice,
+	}
+
+	for _, tier := range p.Tiers {
+		if quantity >= tier.MinQuantity && tier.MinQuantity > quote.TierMinimum {
+			quote.UnitPrice = tier.UnitPrice
+			quote.TierMinimum = tier.MinQuantity
+		}
+	}
+
+	if quote.UnitPrice <= 0 || quote.UnitPrice > MaxUnitPrice {
+		return PriceQuote{}, fmt.Errorf("unit price of %s must be between 1 and %d", p.Name, MaxUnitPrice)
+	}
+
+	quote.Total = quote.UnitPrice * int64(quantity)
+	return quote, nil
+}
+
+// Names returns the product name followed by its aliases, lowercased
+func (p *Product) Names() []string {
+	names := []string{strings.ToLower(strings.TrimSpace(p.Name))}
+	for _, alias := range strings.Split(p.Aliases, ",") {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias != "" {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// Validate checks a product before it is saved
+func (p *Product) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if p.BasePrice <= 0 || p.BasePrice > MaxUnitPrice {
+		return fmt.Errorf("base_price must be between 1 and %d", MaxUnitPrice)
+	}
+
+	seen := make(map[int]bool)
+	for _, tier := range p.Tiers {
+		if tier.MinQuantity < 2 {
+			return fmt.Errorf("tier min_quantity must be at least 2")
+		}
+		if tier.UnitPrice <= 0 || tier.UnitPrice > MaxUnitPrice {
+			return fmt.Errorf("tier unit_price must be between 1 and %d", MaxUnitPrice)
+		}
+		if seen[tier.MinQuantity] {
+			return fmt.Errorf("duplicate tier for min_quantity %d", tier.MinQuantity)
+		}
+		seen[tier.MinQuantity] = true
+	}
+	return nil
+}
+
+func scanProduct(row interface{ Scan(...interface{}) error }) (*Product, error) {
+	var p Product
+	var createdAt, updatedAt string
+
+	err := row.Scan(&p.ID, &p.Name, &p.Aliases, &p.Unit, &p.BasePrice, &p.Enabled, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.CreatedAt = parseTime(createdAt)
+	p.UpdatedAt = parseTime(updatedAt)
+	p.Tiers = []PriceTier{}
+	return &p, nil
+}
+
+// loadTiers fills in the price tiers of the given products
+func loadTiers(products []*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Product)
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	rows, err := DB.Query("SELECT product_id, min_quantity, unit_price FROM product_price_tiers ORDER BY min_quantity ASC")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var tier PriceTier
+		err := rows.Scan(&productID, &tier.MinQuantity, &tier.UnitPrice)
+		if err != nil {
+			return err
+		}
+		if p, ok := byID[productID]; ok {
+			p.Tiers = append(p.Tiers, tier)
+		}
+	}
+
+	return rows.Err()
+}
+
+func queryProducts(query string, args ...interface{}) ([]Product, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []*Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadTiers(products)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Product, len(products))
+	for i, p := range products {
+		result[i] = *p
+	}
+	return result, nil
+}
+
+const productColumns = "id, name, aliases, unit, base_price, enabled, created_at, updated_at"
+
+// ListProducts returns all products ordered by name
+func ListProducts() ([]Product, error) {
+	return queryProducts("SELECT " + productColumns + " FROM products ORDER BY name ASC")
+}
+
+// ListEnabledProducts returns the products the bot can quote
+func ListEnabledProducts() ([]Product, error) {
+	return queryProducts("SELECT " + productColumns + " FROM products WHERE enabled = 1 ORDER BY name ASC")
+}
+
+// GetProduct returns a product with its tiers, or nil if it does not exist
+func GetProduct(id int) (*Product, error) {
+	p, err := scanProduct(DB.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadTiers([]*Product{p})
+	return p, err
+}
+
+// CreateProduct inserts a product with its tiers and sets its ID
+func CreateProduct(p *Product) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO products (name, aliases, unit, base_price, enabled)
+		VALUES (?, ?, ?, ?, ?)
+	`, p.Name, p.Aliases, p.Unit, p.BasePrice, p.Enabled)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	p.ID = int(id)
+
+	err = saveTiers(tx, p)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateProduct saves a product and replaces its tiers
+func UpdateProduct(p *Product) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE products SET name = ?, aliases = ?, unit = ?, base_price = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, p.Name, p.Aliases, p.Unit, p.BasePrice, p.Enabled, p.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM product_price_tiers WHERE product_id = ?", p.ID)
+	if err != nil {
+		return err
+	}
+
+	err = saveTiers(tx, p)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProduct removes a product and its tiers
+func DeleteProduct(id int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM product_price_tiers WHERE product_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM products WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveTiers(tx *sql.Tx, p *Product) error {
+	sort.Slice(p.Tiers, func(i, j int) bool { return p.Tiers[i].MinQuantity < p.Tiers[j].MinQuantity })
+
+	for _, tier := range p.Tiers {
+		_, err := tx.Exec(`
+			INSERT INTO product_price_tiers (product_id, min_quantity, unit_price)
+			VALUES (?, ?, ?)
+		`, p.ID, tier.MinQuantity, tier.UnitPrice)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Validate checks a quick reply before it is saved
+func (q *QuickReply) Validate() error {
+	if strings.TrimSpace(q.Label) == "" {
+		return fmt.Errorf("label cannot be empty")
+	}
+
+	switch q.Action {
+	case QuickReplyMessage:
+		if strings.TrimSpace(q.Payload) == "" {
+			return fmt.Errorf("payload is required for message buttons")
+		}
+	case QuickReplyURL:
+		if !strings.HasPrefix(q.Payload, "http://") && !strings.HasPrefix(q.Payload, "https://") {
+			return fmt.Errorf("payload must be an http(s) link for url buttons")
+		}
+	case QuickReplyHandoff:
+	default:
+		return fmt.Errorf("invalid action %q", q.Action)
+	}
+
+	if q.ShowOn != ShowOnStart && q.ShowOn != ShowOnAlways {
+		return fmt.Errorf("invalid show_on %q", q.ShowOn)
+	}
+	return nil
+}
+
+const quickReplyColumns = "id, label, action, payload, show_on, position, enabled, created_at"
+
+func scanQuickReply(row interface{ Scan(...interface{}) error }) (*QuickReply, error) {
+	var q QuickReply
+	var createdAt string
+
+	err := row.Scan(&q.ID, &q.Label, &q.Action, &q.Payload, &q.ShowOn, &q.Position, &q.Enabled, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	q.CreatedAt = parseTime(createdAt)
+	return &q, nil
+}
+
+func queryQuickReplies(query string, args ...interface{}) ([]QuickReply, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replies []QuickReply
+	for rows.Next() {
+		q, err := scanQuickReply(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, *q)
+	}
+
+	return replies, rows.Err()
+}
+
+// ListQuickReplies returns all quick-reply buttons in display order
+func ListQuickReplies() ([]QuickReply, error) {
+	return queryQuickReplies("SELECT " + quickReplyColumns + " FROM quick_replies ORDER BY position ASC, id ASC")
+}
+
+// ListEnabledQuickReplies returns the enabled buttons shown at the given place
+// ('start' also includes the 'always' buttons)
+func ListEnabledQuickReplies(showOn string) ([]QuickReply, error) {
+	if showOn == ShowOnStart {
+		return queryQuickReplies("SELECT " + quickReplyColumns + " FROM quick_replies WHERE enabled = 1 ORDER BY position ASC, id ASC")
+	}
+	return queryQuickReplies("SELECT "+quickReplyColumns+" FROM quick_replies WHERE enabled = 1 AND show_on = ? ORDER BY position ASC, id ASC", showOn)
+}
+
+// GetQuickReply returns a quick reply, or nil if it does not exist
+func GetQuickReply(id int) (*QuickReply, error) {
+	q, err := scanQuickReply(DB.QueryRow("SELECT "+quickReplyColumns+" FROM quick_replies WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return q, err
+}
+
+// CreateQuickReply inserts a quick reply and sets its ID
+func CreateQuickReply(q *QuickReply) error {
+	result, err := DB.Exec(`
+		INSERT INTO quick_replies (label, action, payload, show_on, position, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, q.Label, q.Action, q.Payload, q.ShowOn, q.Position, q.Enabled)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	q.ID = int(id)
+	return nil
+}
+
+// UpdateQuickReply saves changes to a quick reply
+func UpdateQuickReply(q *QuickReply) error {
+	_, err := DB.Exec(`
+		UPDATE quick_replies SET label = ?, action = ?, payload = ?, show_on = ?, position = ?, enabled = ?
+		WHERE id = ?
+	`, q.Label, q.Action, q.Payload, q.ShowOn, q.Position, q.Enabled, q.ID)
+	return err
+}
+
+// DeleteQuickReply removes a quick reply
+func DeleteQuickReply(id int) error {
+	_, err := DB.Exec("DELETE FROM quick_replies WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Revision actions
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+const revisionColumns = "id, document_id, action, title, category, enabled, content, author, created_at"
+
+// recordRevision stores a snapshot of doc inside the given transaction
+func recordRevision(tx *sql.Tx, doc *KnowledgeBase, action, author string) error {
+	_, err := tx.Exec(`
+		INSERT INTO knowledge_base_revisions (document_id, action, title, category, enabled, content, author)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, doc.ID, action, doc.Title, doc.Category, doc.Enabled, doc.Content, author)
+	return err
+}
+
+// seedKnowledgeRevisions records a revision for every document that has none yet
+func seedKnowledgeRevisions() error {
+	_, err := DB.Exec(`
+		INSERT INTO knowledge_base_revisions (document_id, action, title, category, enabled, content, author, created_at)
+		SELECT kb.id, ?, kb.title, kb.category, kb.enabled, kb.content, 'system', kb.updated_at
+		FROM knowledge_base kb
+		WHERE NOT EXISTS (SELECT 1 FROM knowledge_base_revisions r WHERE r.document_id = kb.id)
+	`, RevisionCreate)
+	return err
+}
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (*KnowledgeRevision, error) {
+	var rev KnowledgeRevision
+	var createdAt string
+
+	err := row.Scan(&rev.ID, &rev.DocumentID, &rev.Action, &rev.Title, &rev.Category,
+		&rev.Enabled, &rev.Content, &rev.Author, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.CreatedAt = parseTime(createdAt)
+	return &rev, nil
+}
+
+// ListKnowledgeRevisions returns revisions newest first. A documentID of 0 lists all documents.
+func ListKnowledgeRevisions(documentID, limit int) ([]KnowledgeRevision, error) {
+	query := "SELECT " + revisionColumns + " FROM knowledge_base_revisions"
+	var args []interface{}
+	if documentID > 0 {
+		query += " WHERE document_id = ?"
+		args = append(args, documentID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []KnowledgeRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetKnowledgeRevision returns a single revision, or nil if it does not exist
+func GetKnowledgeRevision(id int) (*KnowledgeRevision, error) {
+	rev, err := scanRevision(DB.QueryRow("SELECT "+revisionColumns+" FROM knowledge_base_revisions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rev, err
+}
+
+// GetPreviousKnowledgeRevision returns the revision of the same document before rev, or nil
+func GetPreviousKnowledgeRevision(rev *KnowledgeRevision) (*KnowledgeRevision, error) {
+	prev, err := scanRevision(DB.QueryRow(`
+		SELECT `+revisionColumns+` FROM knowledge_base_revisions
+		WHERE document_id = ? AND id < ?
+		ORDER BY id DESC LIMIT 1
+	`, rev.DocumentID, rev.ID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return prev, err
+}
+
+// GetLatestKnowledgeRevisionID returns the newest revision ID across all documents.
+// Together with the revision table it identifies the exact knowledge base state.
+func GetLatestKnowledgeRevisionID() (int, error) {
+	var id sql.NullInt64
+	err := DB.QueryRow("SELECT MAX(id) FROM knowledge_base_revisions").Scan(&id)
+	return int(id.Int64), err
+}
+
+// RestoreKnowledgeRevision puts a document back to the state saved in a revision,
+// re-creating it if it was deleted, and records the restore as a new revision
+func RestoreKnowledgeRevision(revisionID int, author string) (*KnowledgeBase, error) {
+	rev, err := GetKnowledgeRevision(revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if rev == nil {
+		return nil, fmt.Errorf("revision %d not found", revisionID)
+	}
+	if rev.Action == RevisionDelete {
+		return nil, fmt.Errorf("revision %d is a deletion and cannot be restored", revisionID)
+	}
+
+	doc := &KnowledgeBase{
+		ID:       rev.DocumentID,
+		Title:    rev.Title,
+		Category: rev.Category,
+		Enabled:  rev.Enabled,
+		Content:  rev.Content,
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Insert with the original ID if the document was deleted, otherwise update it
+	_, err = tx.Exec(`
+		INSERT INTO knowledge_base (id, title, category, enabled, content)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET title = excluded.title, category = excluded.category,
+			enabled = excluded.enabled, content = excluded.content, updated_at = CURRENT_TIMESTAMP
+	`, doc.ID, doc.Title, doc.Category, doc.Enabled, doc.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(tx, doc, RevisionRestore, author)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetKnowledgeDocument(doc.ID)
+}
@@ -0,0 +1,47 @@
+package database
+
+// SaveToolCall logs a tool call made by the AI
+func SaveToolCall(call *ToolCallLog) error {
+	result, err := DB.Exec(`
+		INSERT INTO tool_calls (conversation_id, tool_name, arguments, result, error, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, call.ConversationID, call.ToolName, call.Arguments, call.Result, call.Error, call.DurationMs)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	call.ID = int(id)
+	return nil
+}
+
+// GetToolCalls returns all tool calls made in a conversation, oldest first
+func GetToolCalls(conversationID int) ([]ToolCallLog, error) {
+	rows, err := DB.Query(`
+		SELECT id, conversation_id, tool_name, arguments, result, error, duration_ms, created_at
+		FROM tool_calls
+		WHERE conversation_id = ?
+		ORDER BY id ASC
+	`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []ToolCallLog
+	for rows.Next() {
+		var call ToolCallLog
+		var createdAt string
+
+		err := rows.Scan(&call.ID, &call.ConversationID, &call.ToolName, &call.Arguments,
+			&call.Result, &call.Error, &call.DurationMs, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		call.CreatedAt = parseTime(createdAt)
+		calls = append(calls, call)
+	}
+
+	return calls, rows.Err()
+}
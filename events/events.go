@@ -0,0 +1,70 @@
+// Package events is an in-process publish/subscribe bus that tells connected
+// dashboards about changes as they happen.
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// Event types published on the bus
+const (
+	MessageCreated       = "message"            // A customer, bot or admin message was stored
+	MessageUpdated       = "message_updated"    // A stored message changed, e.g. a voice note was transcribed
+	BotActiveChanged     = "bot_active"         // The bot was paused or resumed for a conversation
+	AssignmentChanged    = "assignment"         // A conversation was claimed, released or transferred
+	HandoffRequested     = "handoff"            // The bot handed a conversation to a human
+	KnowledgeBaseChanged = "knowledge_base"     // A knowledge base document was created, edited, deleted or restored
+	ConversationEvent    = "conversation_event" // A button press or similar event was recorded
+)
+
+// Event is a change pushed to subscribers
+type Event struct {
+	Type           string      `json:"type"`
+	ConversationID int         `json:"conversation_id,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before
+// events are dropped for it
+const subscriberBuffer = 64
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[chan Event]struct{}{}
+)
+
+// Subscribe returns a channel receiving every published event and a function that
+// unsubscribes and closes the channel
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, ch)
+			mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers without blocking. Subscribers that are
+// too far behind miss the event; the dashboard reloads from the API anyway.
+func Publish(event Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[EVENTS] Subscriber is behind, dropped %s event", event.Type)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"telecust/api"
 	"telecust/bot"
 	"telecust/database"
 
 	"github.com/joho/godotenv"
+	"golang.org/x/term"
 )
 
 func main() {
@@ -27,6 +31,16 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// "telecust create-admin <username> [role]" adds a dashboard login and exits
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		createAdmin(os.Args[2:])
+		return
+	}
+
+	if count, err := database.CountAdminUsers(); err == nil && count == 0 {
+		log.Println("Warning: no dashboard users yet. Create one with: telecust create-admin <username>")
+	}
+
 	// Get bot token from environment (support both variable names)
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if botToken == "" {
@@ -36,12 +50,22 @@ func main() {
 		log.Fatal("TELEGRAM_BOT_TOKEN or TELE_BOT_TOKEN environment variable is required")
 	}
 
-	// Check OpenAI API key
-	openaiKey := os.Getenv("OPENAI_API_KEY")
-	if openaiKey == "" {
-		log.Println("Warning: OPENAI_API_KEY not set. Bot will not be able to respond intelligently.")
-	} else {
-		log.Println("OpenAI API configured successfully")
+	// Initialize AI provider (selected by AI_PROVIDER)
+	err = bot.InitProvider()
+	if err != nil {
+		log.Printf("Warning: %v. Bot will not be able to respond intelligently.", err)
+	}
+
+	// Initialize knowledge base retrieval (indexes in the background)
+	err = bot.InitRetrieval()
+	if err != nil {
+		log.Printf("Warning: knowledge base retrieval disabled: %v", err)
+	}
+
+	// Initialize voice message transcription
+	err = bot.InitTranscription()
+	if err != nil {
+		log.Printf("Warning: voice transcription disabled: %v", err)
 	}
 
 	// Initialize bot
@@ -56,3 +80,48 @@ func main() {
 	// Start API server (blocking)
 	api.StartServer()
 }
+
+// createAdmin creates a dashboard user, an owner unless another role is given. The
+// password is taken from ADMIN_PASSWORD, prompted for on a terminal, or read from the
+// first line of stdin.
+func createAdmin(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: telecust create-admin <username> [owner|agent|viewer]")
+		os.Exit(2)
+	}
+
+	role := database.RoleOwner
+	if len(args) == 2 {
+		role = args[1]
+	}
+	if !database.ValidRole(role) {
+		log.Fatalf("Invalid role %q, use owner, agent or viewer", role)
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Print("Password: ")
+			input, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				log.Fatalf("Failed to read password: %v", err)
+			}
+			password = string(input)
+		} else {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				log.Fatalf("Failed to read password: %v", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+	}
+
+	user := &database.AdminUser{Username: args[0], Role: role}
+	err := database.CreateAdminUser(user, password)
+	if err != nil {
+		log.Fatalf("Failed to create admin user: %v", err)
+	}
+
+	log.Printf("Created dashboard user %q (%s)", user.Username, user.Role)
+}
@@ -2,7 +2,22 @@
 let currentConversation = null;
 let conversations = [];
 let messages = [];
+let events = [];
+let renderedTranscript = '';
 let refreshInterval = null;
+let eventSource = null;
+let liveUpdates = false;
+let kbDocuments = [];
+let currentDocument = null;
+let revisions = [];
+let products = [];
+let orders = [];
+let quickReplies = [];
+let adminUsers = [];
+let auditEntries = [];
+let me = null;
+let currentProduct = null;
+let currentRevision = null;
 
 // DOM Elements
 const conversationsList = document.getElementById('conversationsList');
@@ -13,23 +28,100 @@ const chatUsername = document.getElementById('chatUsername');
 const messagesContainer = document.getElementById('messagesContainer');
 const messageInput = document.getElementById('messageInput');
 const sendBtn = document.getElementById('sendBtn');
+const attachBtn = document.getElementById('attachBtn');
+const fileInput = document.getElementById('fileInput');
+const selectedFile = document.getElementById('selectedFile');
+const selectedFileName = document.getElementById('selectedFileName');
+const sendAsDocument = document.getElementById('sendAsDocument');
+const clearFileBtn = document.getElementById('clearFileBtn');
 const toggleBotBtn = document.getElementById('toggleBotBtn');
+const takeoverTimeout = document.getElementById('takeoverTimeout');
+const chatAssignee = document.getElementById('chatAssignee');
+const claimBtn = document.getElementById('claimBtn');
+const releaseBtn = document.getElementById('releaseBtn');
+const transferBtn = document.getElementById('transferBtn');
+const conversationFilter = document.getElementById('conversationFilter');
 const settingsBtn = document.getElementById('settingsBtn');
 const settingsModal = document.getElementById('settingsModal');
-const closeBtn = document.querySelector('.close-btn');
+const closeBtns = document.querySelectorAll('.close-btn');
 const cancelBtn = document.getElementById('cancelBtn');
 const saveKBBtn = document.getElementById('saveKBBtn');
 const knowledgeBaseInput = document.getElementById('knowledgeBaseInput');
+const documentsList = document.getElementById('documentsList');
+const newDocBtn = document.getElementById('newDocBtn');
+const deleteDocBtn = document.getElementById('deleteDocBtn');
+const docTitleInput = document.getElementById('docTitleInput');
+const docCategoryInput = document.getElementById('docCategoryInput');
+const docEnabledInput = document.getElementById('docEnabledInput');
+const historyBtn = document.getElementById('historyBtn');
+const historyModal = document.getElementById('historyModal');
+const historyTitle = document.getElementById('historyTitle');
+const revisionsList = document.getElementById('revisionsList');
+const revisionInfo = document.getElementById('revisionInfo');
+const revisionDiff = document.getElementById('revisionDiff');
+const restoreRevisionBtn = document.getElementById('restoreRevisionBtn');
+const ordersBtn = document.getElementById('ordersBtn');
+const ordersModal = document.getElementById('ordersModal');
+const ordersList = document.getElementById('ordersList');
+const orderStatusFilter = document.getElementById('orderStatusFilter');
+const usersBtn = document.getElementById('usersBtn');
+const usersModal = document.getElementById('usersModal');
+const usersList = document.getElementById('usersList');
+const newUsernameInput = document.getElementById('newUsernameInput');
+const newPasswordInput = document.getElementById('newPasswordInput');
+const newRoleInput = document.getElementById('newRoleInput');
+const addUserBtn = document.getElementById('addUserBtn');
+const auditBtn = document.getElementById('auditBtn');
+const auditModal = document.getElementById('auditModal');
+const auditList = document.getElementById('auditList');
+const auditActorFilter = document.getElementById('auditActorFilter');
+const auditActionFilter = document.getElementById('auditActionFilter');
+const auditSinceFilter = document.getElementById('auditSinceFilter');
+const auditUntilFilter = document.getElementById('auditUntilFilter');
+const quickRepliesBtn = document.getElementById('quickRepliesBtn');
+const quickRepliesModal = document.getElementById('quickRepliesModal');
+const quickRepliesList = document.getElementById('quickRepliesList');
+const addQuickReplyBtn = document.getElementById('addQuickReplyBtn');
+const productsBtn = document.getElementById('productsBtn');
+const productsModal = document.getElementById('productsModal');
+const productsList = document.getElementById('productsList');
+const newProductBtn = document.getElementById('newProductBtn');
+const productNameInput = document.getElementById('productNameInput');
+const productUnitInput = document.getElementById('productUnitInput');
+const productEnabledInput = document.getElementById('productEnabledInput');
+const productAliasesInput = document.getElementById('productAliasesInput');
+const productPriceInput = document.getElementById('productPriceInput');
+const addTierBtn = document.getElementById('addTierBtn');
+const tiersList = document.getElementById('tiersList');
+const quoteQuantityInput = document.getElementById('quoteQuantityInput');
+const quoteResult = document.getElementById('quoteResult');
+const deleteProductBtn = document.getElementById('deleteProductBtn');
+const saveProductBtn = document.getElementById('saveProductBtn');
 
 // Initialize
 init();
 
 function init() {
-    loadConversations();
+    loadMe();
+    if (window.Notification && Notification.permission === 'default') {
+        Notification.requestPermission();
+    }
+    window.addEventListener('focus', () => {
+        document.title = document.title.replace(/^\(!\) /, '');
+    });
+    loadConversations().then(openLinkedConversation);
     setupEventListeners();
     startAutoRefresh();
 }
 
+// Staff group notifications link to /?conversation=<id>
+function openLinkedConversation() {
+    const id = Number(new URLSearchParams(window.location.search).get('conversation'));
+    if (id) {
+        selectConversation(id);
+    }
+}
+
 function setupEventListeners() {
     sendBtn.addEventListener('click', sendMessage);
     messageInput.addEventListener('keypress', (e) => {
@@ -39,36 +131,165 @@ function setupEventListeners() {
         }
     });
 
+    attachBtn.addEventListener('click', () => fileInput.click());
+    fileInput.addEventListener('change', showSelectedFile);
+    clearFileBtn.addEventListener('click', clearSelectedFile);
     toggleBotBtn.addEventListener('click', toggleBot);
+    takeoverTimeout.addEventListener('change', setTakeoverTimeout);
+    claimBtn.addEventListener('click', () => changeAssignment('claim'));
+    releaseBtn.addEventListener('click', () => changeAssignment('release'));
+    transferBtn.addEventListener('click', transferConversation);
+    conversationFilter.addEventListener('change', loadConversations);
     settingsBtn.addEventListener('click', openSettings);
-    closeBtn.addEventListener('click', closeSettings);
+    closeBtns.forEach(btn => {
+        btn.addEventListener('click', () => btn.closest('.modal').classList.remove('active'));
+    });
     cancelBtn.addEventListener('click', closeSettings);
     saveKBBtn.addEventListener('click', saveKnowledgeBase);
+    newDocBtn.addEventListener('click', () => editDocument(null));
+    deleteDocBtn.addEventListener('click', deleteDocument);
+    historyBtn.addEventListener('click', openHistory);
+    restoreRevisionBtn.addEventListener('click', restoreRevision);
+    ordersBtn.addEventListener('click', openOrders);
+    orderStatusFilter.addEventListener('change', loadOrders);
+    quickRepliesBtn.addEventListener('click', openQuickReplies);
+    usersBtn.addEventListener('click', openUsers);
+    addUserBtn.addEventListener('click', addUser);
+    auditBtn.addEventListener('click', openAudit);
+    [auditActorFilter, auditActionFilter, auditSinceFilter, auditUntilFilter].forEach(input => {
+        input.addEventListener('change', loadAudit);
+    });
+    addQuickReplyBtn.addEventListener('click', () => addQuickReplyRow(null));
+    productsBtn.addEventListener('click', openProducts);
+    newProductBtn.addEventListener('click', () => editProduct(null));
+    addTierBtn.addEventListener('click', () => addTierRow({ min_quantity: '', unit_price: '' }));
+    saveProductBtn.addEventListener('click', saveProduct);
+    deleteProductBtn.addEventListener('click', deleteProduct);
+    quoteQuantityInput.addEventListener('input', updateQuotePreview);
 
-    // Close modal on outside click
-    settingsModal.addEventListener('click', (e) => {
-        if (e.target === settingsModal) {
-            closeSettings();
-        }
+    // Close modals on outside click
+    document.querySelectorAll('.modal').forEach(modal => {
+        modal.addEventListener('click', (e) => {
+            if (e.target === modal) {
+                modal.classList.remove('active');
+            }
+        });
     });
 }
 
-// Auto refresh
+// Auto refresh: live updates over Server-Sent Events, polling while they are unavailable
 function startAutoRefresh() {
+    let ticks = 0;
     refreshInterval = setInterval(() => {
+        ticks++;
+        // While live, still catch up every 30s in case an event was missed
+        if (liveUpdates && ticks % 10 !== 0) return;
+        refreshAll();
+    }, 3000);
+    connectEvents();
+}
+
+function refreshAll() {
+    loadConversations();
+    if (currentConversation) {
+        loadMessages(currentConversation.id);
+    }
+}
+
+function connectEvents() {
+    if (!window.EventSource) return;
+
+    eventSource = new EventSource('/api/events');
+    eventSource.addEventListener('open', () => {
+        liveUpdates = true;
+        // Catch up on anything missed while disconnected
+        refreshAll();
+    });
+    eventSource.addEventListener('error', () => {
+        // The browser reconnects by itself; poll until it does
+        liveUpdates = eventSource.readyState === EventSource.OPEN;
+    });
+
+    eventSource.addEventListener('message', (e) => {
+        const event = JSON.parse(e.data);
         loadConversations();
-        if (currentConversation) {
-            loadMessages(currentConversation.id);
+        if (isCurrentConversation(event.conversation_id)) {
+            loadMessages(event.conversation_id);
         }
-    }, 3000);
+    });
+    eventSource.addEventListener('message_updated', (e) => {
+        const event = JSON.parse(e.data);
+        if (isCurrentConversation(event.conversation_id)) {
+            loadMessages(event.conversation_id);
+        }
+    });
+    eventSource.addEventListener('conversation_event', (e) => {
+        const event = JSON.parse(e.data);
+        if (isCurrentConversation(event.conversation_id)) {
+            loadMessages(event.conversation_id);
+        }
+    });
+    eventSource.addEventListener('bot_active', (e) => {
+        const event = JSON.parse(e.data);
+        if (isCurrentConversation(event.conversation_id)) {
+            currentConversation.is_bot_active = event.data.is_bot_active;
+            updateToggleButton();
+        }
+        loadConversations();
+    });
+    eventSource.addEventListener('handoff', (e) => {
+        notifyHandoff(JSON.parse(e.data));
+        loadConversations();
+    });
+    eventSource.addEventListener('assignment', (e) => {
+        const event = JSON.parse(e.data);
+        if (isCurrentConversation(event.conversation_id)) {
+            currentConversation.assigned_agent = event.data.assigned_agent;
+            updateToggleButton();
+        }
+        loadConversations();
+    });
+    eventSource.addEventListener('knowledge_base', () => {
+        if (settingsModal.classList.contains('active')) {
+            loadDocuments().catch(error => console.error('Error loading documents:', error));
+        }
+    });
+}
+
+// Alert agents that the bot handed a conversation over, with a desktop notification when allowed
+function notifyHandoff(event) {
+    if (!hasRole('agent')) return;
+
+    const text = `${event.data.customer} needs a human: ${event.data.reason}`;
+    if (window.Notification && Notification.permission === 'granted') {
+        const notification = new Notification('Handoff requested', { body: text, tag: `handoff-${event.conversation_id}` });
+        notification.onclick = () => {
+            window.focus();
+            selectConversation(event.conversation_id);
+        };
+    } else if (!document.title.startsWith('(!)')) {
+        document.title = `(!) ${document.title}`;
+    }
+}
+
+function isCurrentConversation(id) {
+    return currentConversation && currentConversation.id === id;
 }
 
 // API Calls
 async function loadConversations() {
     try {
-        const response = await fetch('/api/conversations');
+        const filter = conversationFilter.value;
+        const response = await fetch(filter ? `/api/conversations?filter=${filter}` : '/api/conversations');
         const data = await response.json();
         conversations = data || [];
+
+        // Keep the open conversation's state fresh, even when the filter hides it
+        const current = currentConversation && conversations.find(c => c.id === currentConversation.id);
+        if (current) {
+            currentConversation = current;
+            updateToggleButton();
+        }
         renderConversations();
     } catch (error) {
         console.error('Error loading conversations:', error);
@@ -77,9 +298,18 @@ async function loadConversations() {
 
 async function loadMessages(conversationId) {
     try {
-        const response = await fetch(`/api/conversations/${conversationId}/messages`);
-        const data = await response.json();
-        messages = data || [];
+        const [messagesResponse, eventsResponse] = await Promise.all([
+            fetch(`/api/conversations/${conversationId}/messages`),
+            fetch(`/api/conversations/${conversationId}/events`),
+        ]);
+        messages = (await messagesResponse.json()) || [];
+        events = (await eventsResponse.json()) || [];
+
+        // Skip re-rendering unchanged transcripts so media players keep playing
+        const transcript = JSON.stringify([conversationId, messages, events]);
+        if (transcript === renderedTranscript) return;
+        renderedTranscript = transcript;
+
         renderMessages();
         scrollToBottom();
     } catch (error) {
@@ -91,27 +321,95 @@ async function sendMessage() {
     if (!currentConversation) return;
 
     const text = messageInput.value.trim();
-    if (!text) return;
+    const file = fileInput.files[0];
+    if (!text && !file) return;
 
-    try {
-        const response = await fetch(`/api/conversations/${currentConversation.id}/send`, {
+    let options;
+    if (file) {
+        // Files go as multipart, with the text as caption
+        const form = new FormData();
+        form.append('file', file);
+        form.append('message', text);
+        if (sendAsDocument.checked) {
+            form.append('kind', 'document');
+        }
+        options = { method: 'POST', body: form };
+    } else {
+        options = {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
             },
             body: JSON.stringify({ message: text }),
-        });
+        };
+    }
+
+    try {
+        sendBtn.disabled = true;
+        const response = await fetch(`/api/conversations/${currentConversation.id}/send`, options);
 
         if (response.ok) {
             messageInput.value = '';
+            clearSelectedFile();
             loadMessages(currentConversation.id);
         } else {
-            alert('Failed to send message');
+            alert(`Failed to send message: ${await response.text()}`);
         }
     } catch (error) {
         console.error('Error sending message:', error);
         alert('Error sending message');
+    } finally {
+        sendBtn.disabled = false;
+    }
+}
+
+function showSelectedFile() {
+    const file = fileInput.files[0];
+    if (!file) {
+        clearSelectedFile();
+        return;
     }
+
+    selectedFileName.textContent = `📎 ${file.name} (${formatFileSize(file.size)})`;
+    sendAsDocument.checked = !file.type.startsWith('image/');
+    selectedFile.style.display = 'flex';
+}
+
+function clearSelectedFile() {
+    fileInput.value = '';
+    sendAsDocument.checked = false;
+    selectedFile.style.display = 'none';
+}
+
+async function changeAssignment(action, body) {
+    if (!currentConversation) return;
+
+    try {
+        const response = await fetch(`/api/conversations/${currentConversation.id}/${action}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: body ? JSON.stringify(body) : undefined,
+        });
+
+        if (response.ok) {
+            currentConversation = await response.json();
+            updateToggleButton();
+            loadConversations();
+        } else {
+            alert(`Failed to ${action} conversation: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error(`Error during ${action}:`, error);
+        alert(`Error during ${action}`);
+    }
+}
+
+function transferConversation() {
+    const agent = prompt('Transfer to which agent (username)?');
+    if (!agent) return;
+    changeAssignment('transfer', { agent: agent.trim() });
 }
 
 async function toggleBot() {
@@ -126,6 +424,11 @@ async function toggleBot() {
 
         if (response.ok) {
             currentConversation.is_bot_active = !currentConversation.is_bot_active;
+            if (currentConversation.is_bot_active) {
+                currentConversation.assigned_agent = '';
+            } else if (!currentConversation.assigned_agent && me) {
+                currentConversation.assigned_agent = me.username;
+            }
             updateToggleButton();
             loadConversations();
         } else {
@@ -137,11 +440,35 @@ async function toggleBot() {
     }
 }
 
+async function setTakeoverTimeout() {
+    if (!currentConversation) return;
+
+    const value = takeoverTimeout.value;
+    try {
+        const response = await fetch(`/api/conversations/${currentConversation.id}/takeover-timeout`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ minutes: value === '' ? null : Number(value) }),
+        });
+
+        if (response.ok) {
+            currentConversation = await response.json();
+        } else {
+            alert(`Failed to set auto-resume: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error setting takeover timeout:', error);
+        alert('Error setting auto-resume');
+    }
+    updateToggleButton();
+}
+
 async function openSettings() {
     try {
-        const response = await fetch('/api/knowledge-base');
-        const data = await response.json();
-        knowledgeBaseInput.value = data.content || '';
+        await loadDocuments();
+        editDocument(kbDocuments.length > 0 ? kbDocuments[0] : null);
         settingsModal.classList.add('active');
     } catch (error) {
         console.error('Error loading knowledge base:', error);
@@ -153,25 +480,59 @@ function closeSettings() {
     settingsModal.classList.remove('active');
 }
 
+async function loadDocuments() {
+    const response = await fetch('/api/knowledge-base/documents');
+    if (!response.ok) {
+        throw new Error(`HTTP ${response.status}`);
+    }
+    kbDocuments = (await response.json()) || [];
+    renderDocuments();
+}
+
+function editDocument(doc) {
+    currentDocument = doc;
+    docTitleInput.value = doc ? doc.title : '';
+    docCategoryInput.value = doc ? doc.category : '';
+    docEnabledInput.checked = doc ? doc.enabled : true;
+    knowledgeBaseInput.value = doc ? doc.content : '';
+    deleteDocBtn.style.display = doc ? '' : 'none';
+    historyBtn.style.display = doc ? '' : 'none';
+    renderDocuments();
+}
+
 async function saveKnowledgeBase() {
+    const title = docTitleInput.value.trim();
     const content = knowledgeBaseInput.value.trim();
-    if (!content) {
-        alert('Knowledge base cannot be empty');
+    if (!title || !content) {
+        alert('Title and content cannot be empty');
         return;
     }
 
+    const payload = {
+        title,
+        category: docCategoryInput.value.trim(),
+        enabled: docEnabledInput.checked,
+        content,
+    };
+
+    const url = currentDocument
+        ? `/api/knowledge-base/documents/${currentDocument.id}`
+        : '/api/knowledge-base/documents';
+
     try {
-        const response = await fetch('/api/knowledge-base', {
-            method: 'PUT',
+        const response = await fetch(url, {
+            method: currentDocument ? 'PUT' : 'POST',
             headers: {
                 'Content-Type': 'application/json',
             },
-            body: JSON.stringify({ content }),
+            body: JSON.stringify(payload),
         });
 
         if (response.ok) {
+            const saved = await response.json();
+            await loadDocuments();
+            editDocument(kbDocuments.find(d => d.id === saved.id) || null);
             alert('Knowledge base updated successfully');
-            closeSettings();
         } else {
             alert('Failed to update knowledge base');
         }
@@ -181,6 +542,622 @@ async function saveKnowledgeBase() {
     }
 }
 
+async function deleteDocument() {
+    if (!currentDocument) return;
+    if (!confirm(`Delete "${currentDocument.title}"?`)) return;
+
+    try {
+        const response = await fetch(`/api/knowledge-base/documents/${currentDocument.id}`, {
+            method: 'DELETE',
+        });
+
+        if (response.ok) {
+            await loadDocuments();
+            editDocument(kbDocuments.length > 0 ? kbDocuments[0] : null);
+        } else {
+            alert('Failed to delete document');
+        }
+    } catch (error) {
+        console.error('Error deleting document:', error);
+        alert('Error deleting document');
+    }
+}
+
+async function openHistory() {
+    if (!currentDocument) return;
+
+    historyTitle.textContent = `Revision History: ${currentDocument.title}`;
+    revisionInfo.textContent = '';
+    revisionDiff.innerHTML = '';
+    currentRevision = null;
+    restoreRevisionBtn.disabled = true;
+
+    try {
+        const response = await fetch(`/api/knowledge-base/revisions?document_id=${currentDocument.id}`);
+        revisions = (await response.json()) || [];
+        renderRevisions();
+        historyModal.classList.add('active');
+        if (revisions.length > 0) {
+            showRevision(revisions[0]);
+        }
+    } catch (error) {
+        console.error('Error loading revisions:', error);
+        alert('Error loading revisions');
+    }
+}
+
+async function showRevision(rev) {
+    currentRevision = rev;
+    renderRevisions();
+    restoreRevisionBtn.disabled = rev.action === 'delete';
+    revisionInfo.textContent = `#${rev.id} ${rev.action} by ${rev.author || 'unknown'} on ${new Date(rev.created_at).toLocaleString()}`;
+
+    try {
+        const response = await fetch(`/api/knowledge-base/revisions/diff?to=${rev.id}`);
+        const data = await response.json();
+        revisionDiff.innerHTML = data.lines.map(line => {
+            const prefix = line.type === 'insert' ? '+ ' : line.type === 'delete' ? '- ' : '  ';
+            return `<div class="diff-line ${line.type}">${escapeHtml(prefix + line.text)}</div>`;
+        }).join('');
+    } catch (error) {
+        console.error('Error loading diff:', error);
+        revisionDiff.textContent = 'Error loading diff';
+    }
+}
+
+async function restoreRevision() {
+    if (!currentRevision) return;
+    if (!confirm(`Restore revision #${currentRevision.id}?`)) return;
+
+    try {
+        const response = await fetch(`/api/knowledge-base/revisions/${currentRevision.id}/restore`, {
+            method: 'POST',
+        });
+
+        if (response.ok) {
+            const doc = await response.json();
+            historyModal.classList.remove('active');
+            await loadDocuments();
+            editDocument(kbDocuments.find(d => d.id === doc.id) || null);
+            alert('Revision restored');
+        } else {
+            alert('Failed to restore revision');
+        }
+    } catch (error) {
+        console.error('Error restoring revision:', error);
+        alert('Error restoring revision');
+    }
+}
+
+async function openOrders() {
+    ordersModal.classList.add('active');
+    await loadOrders();
+}
+
+async function loadOrders() {
+    const status = orderStatusFilter.value;
+    const url = status ? `/api/orders?status=${encodeURIComponent(status)}` : '/api/orders';
+
+    try {
+        const response = await fetch(url);
+        orders = (await response.json()) || [];
+        renderOrders();
+    } catch (error) {
+        console.error('Error loading orders:', error);
+        ordersList.innerHTML = '<div class="loading">Error loading orders</div>';
+    }
+}
+
+async function setOrderStatus(orderId, status) {
+    try {
+        const response = await fetch(`/api/orders/${orderId}/status`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ status }),
+        });
+
+        if (response.ok) {
+            await loadOrders();
+        } else {
+            alert('Failed to update order');
+        }
+    } catch (error) {
+        console.error('Error updating order:', error);
+        alert('Error updating order');
+    }
+}
+
+// Dashboard users
+async function loadMe() {
+    try {
+        const response = await fetch('/api/me');
+        me = await response.json();
+        applyRole();
+    } catch (error) {
+        console.error('Error loading current user:', error);
+    }
+}
+
+const roleRank = { viewer: 1, agent: 2, owner: 3 };
+
+function hasRole(role) {
+    return me && roleRank[me.role] >= roleRank[role];
+}
+
+// Hide controls the server would refuse for the current user's role
+function applyRole() {
+    const isOwner = hasRole('owner');
+    [productsBtn, quickRepliesBtn, settingsBtn, usersBtn, auditBtn].forEach(btn => {
+        btn.style.display = isOwner ? '' : 'none';
+    });
+
+    const isAgent = hasRole('agent');
+    toggleBotBtn.style.display = isAgent ? '' : 'none';
+    document.querySelector('.message-input-container').style.display = isAgent ? '' : 'none';
+    if (currentConversation) updateToggleButton();
+}
+
+async function openUsers() {
+    try {
+        const response = await fetch('/api/admin-users');
+        adminUsers = (await response.json()) || [];
+        renderUsers();
+        usersModal.classList.add('active');
+    } catch (error) {
+        console.error('Error loading users:', error);
+        alert('Error loading users');
+    }
+}
+
+function renderUsers() {
+    usersList.innerHTML = adminUsers.map(user => `
+        <div class="user-row" data-id="${user.id}">
+            <span class="user-name">${escapeHtml(user.username)}${me && me.id === user.id ? ' (you)' : ''}</span>
+            <span class="user-login">${user.last_login_at ? `Last login ${formatTime(user.last_login_at)}` : 'Never logged in'}</span>
+            <select class="form-input user-role">
+                ${['owner', 'agent', 'viewer'].map(role => `<option value="${role}"${user.role === role ? ' selected' : ''}>${role}</option>`).join('')}
+            </select>
+            <button class="btn btn-secondary user-password">Set Password</button>
+            <button class="btn btn-secondary user-telegram" title="Telegram account used in the staff group and forum">${user.telegram_id ? `Telegram ${user.telegram_id}` : 'Link Telegram'}</button>
+            ${me && me.id === user.id ? '' : '<button class="btn btn-danger user-delete">&times;</button>'}
+        </div>
+    `).join('');
+
+    usersList.querySelectorAll('.user-row').forEach(row => {
+        const user = adminUsers.find(u => u.id === parseInt(row.dataset.id));
+        row.querySelector('.user-password').addEventListener('click', () => setUserPassword(user));
+        row.querySelector('.user-role').addEventListener('change', (e) => setUserRole(user, e.target.value));
+        row.querySelector('.user-telegram').addEventListener('click', () => setUserTelegram(user));
+        const deleteBtn = row.querySelector('.user-delete');
+        if (deleteBtn) {
+            deleteBtn.addEventListener('click', () => deleteUser(user));
+        }
+    });
+}
+
+async function addUser() {
+    const username = newUsernameInput.value.trim();
+    const password = newPasswordInput.value;
+    const role = newRoleInput.value;
+    if (!username || !password) {
+        alert('Username and password are required');
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/admin-users', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ username, password, role }),
+        });
+
+        if (response.ok) {
+            newUsernameInput.value = '';
+            newPasswordInput.value = '';
+            await openUsers();
+        } else {
+            alert(`Failed to add user: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error adding user:', error);
+        alert('Error adding user');
+    }
+}
+
+async function setUserPassword(user) {
+    const password = prompt(`New password for ${user.username}:`);
+    if (!password) return;
+
+    try {
+        const response = await fetch(`/api/admin-users/${user.id}/password`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ password }),
+        });
+
+        if (response.ok) {
+            alert('Password updated');
+        } else {
+            alert(`Failed to update password: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error updating password:', error);
+        alert('Error updating password');
+    }
+}
+
+async function setUserRole(user, role) {
+    try {
+        const response = await fetch(`/api/admin-users/${user.id}/role`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ role }),
+        });
+
+        if (!response.ok) {
+            alert(`Failed to change role: ${await response.text()}`);
+        }
+        if (me && me.id === user.id) {
+            await loadMe();
+        }
+        await openUsers();
+    } catch (error) {
+        console.error('Error changing role:', error);
+        alert('Error changing role');
+    }
+}
+
+async function setUserTelegram(user) {
+    const value = prompt(`Numeric Telegram user ID of ${user.username} (empty to unlink):`, user.telegram_id || '');
+    if (value === null) return;
+
+    const telegramId = value.trim() === '' ? 0 : Number(value.trim());
+    if (!Number.isInteger(telegramId) || telegramId < 0) {
+        alert('The Telegram user ID must be a number');
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/admin-users/${user.id}/telegram`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ telegram_id: telegramId }),
+        });
+
+        if (!response.ok) {
+            alert(`Failed to link Telegram account: ${await response.text()}`);
+        }
+        await openUsers();
+    } catch (error) {
+        console.error('Error linking Telegram account:', error);
+        alert('Error linking Telegram account');
+    }
+}
+
+async function deleteUser(user) {
+    if (!confirm(`Delete user "${user.username}"?`)) return;
+
+    try {
+        const response = await fetch(`/api/admin-users/${user.id}`, {
+            method: 'DELETE',
+        });
+
+        if (response.ok) {
+            await openUsers();
+        } else {
+            alert(`Failed to delete user: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error deleting user:', error);
+        alert('Error deleting user');
+    }
+}
+
+// Audit log
+async function openAudit() {
+    auditModal.classList.add('active');
+    await loadAudit();
+}
+
+async function loadAudit() {
+    const params = new URLSearchParams();
+    if (auditActorFilter.value.trim()) params.set('actor', auditActorFilter.value.trim());
+    if (auditActionFilter.value) params.set('action', auditActionFilter.value);
+    if (auditSinceFilter.value) params.set('since', auditSinceFilter.value);
+    if (auditUntilFilter.value) params.set('until', auditUntilFilter.value);
+
+    try {
+        const response = await fetch(`/api/audit?${params}`);
+        auditEntries = (await response.json()) || [];
+        renderAudit();
+    } catch (error) {
+        console.error('Error loading audit log:', error);
+        auditList.innerHTML = '<div class="loading">Error loading audit log</div>';
+    }
+}
+
+function renderAudit() {
+    if (auditEntries.length === 0) {
+        auditList.innerHTML = '<div class="loading">No matching entries</div>';
+        return;
+    }
+
+    auditList.innerHTML = auditEntries.map(entry => {
+        const target = entry.target_type ? `${entry.target_type}${entry.target_id ? ' #' + entry.target_id : ''}` : '';
+        const failed = entry.status >= 400;
+
+        return `
+            <div class="order-item">
+                <div class="order-header">
+                    <div>
+                        <span class="order-title">${escapeHtml(entry.action)}</span>
+                        <span class="order-meta">${escapeHtml(target)}</span>
+                    </div>
+                    <span class="order-status ${failed ? 'cancelled' : 'completed'}">${entry.status}</span>
+                </div>
+                <div class="order-meta">${escapeHtml(entry.actor || 'unknown')} &middot; ${escapeHtml(entry.ip)} &middot; ${formatTime(entry.created_at)}</div>
+                ${entry.before || entry.after ? `
+                    <details class="audit-change">
+                        <summary>Changes</summary>
+                        ${entry.before ? `<div class="order-meta">Before</div><pre>${escapeHtml(formatAuditJSON(entry.before))}</pre>` : ''}
+                        ${entry.after ? `<div class="order-meta">After</div><pre>${escapeHtml(formatAuditJSON(entry.after))}</pre>` : ''}
+                    </details>
+                ` : ''}
+            </div>
+        `;
+    }).join('');
+}
+
+function formatAuditJSON(value) {
+    try {
+        return JSON.stringify(JSON.parse(value), null, 2);
+    } catch (error) {
+        return value;
+    }
+}
+
+async function openQuickReplies() {
+    try {
+        const response = await fetch('/api/quick-replies');
+        quickReplies = (await response.json()) || [];
+        quickRepliesList.innerHTML = '';
+        quickReplies.forEach(addQuickReplyRow);
+        quickRepliesModal.classList.add('active');
+    } catch (error) {
+        console.error('Error loading quick replies:', error);
+        alert('Error loading quick replies');
+    }
+}
+
+function addQuickReplyRow(reply) {
+    const row = document.createElement('div');
+    row.className = 'quick-reply-row';
+    row.innerHTML = `
+        <input class="form-input qr-label" type="text" placeholder="Button text">
+        <select class="form-input qr-action">
+            <option value="message">Send text</option>
+            <option value="handoff">Hand to admin</option>
+            <option value="url">Open link</option>
+        </select>
+        <input class="form-input qr-payload" type="text" placeholder="Text or link">
+        <select class="form-input qr-show-on">
+            <option value="start">Welcome only</option>
+            <option value="always">Every reply</option>
+        </select>
+        <label class="form-checkbox"><input class="qr-enabled" type="checkbox"> On</label>
+        <button class="btn btn-primary qr-save">Save</button>
+        <button class="btn btn-danger qr-delete">&times;</button>
+    `;
+
+    row.querySelector('.qr-label').value = reply ? reply.label : '';
+    row.querySelector('.qr-action').value = reply ? reply.action : 'message';
+    row.querySelector('.qr-payload').value = reply ? reply.payload : '';
+    row.querySelector('.qr-show-on').value = reply ? reply.show_on : 'start';
+    row.querySelector('.qr-enabled').checked = reply ? reply.enabled : true;
+
+    row.querySelector('.qr-save').addEventListener('click', () => saveQuickReply(row, reply));
+    row.querySelector('.qr-delete').addEventListener('click', () => deleteQuickReply(row, reply));
+    quickRepliesList.appendChild(row);
+}
+
+async function saveQuickReply(row, reply) {
+    const payload = {
+        label: row.querySelector('.qr-label').value.trim(),
+        action: row.querySelector('.qr-action').value,
+        payload: row.querySelector('.qr-payload').value.trim(),
+        show_on: row.querySelector('.qr-show-on').value,
+        enabled: row.querySelector('.qr-enabled').checked,
+        position: Array.from(quickRepliesList.children).indexOf(row) + 1,
+    };
+
+    try {
+        const response = await fetch(reply ? `/api/quick-replies/${reply.id}` : '/api/quick-replies', {
+            method: reply ? 'PUT' : 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(payload),
+        });
+
+        if (response.ok) {
+            await openQuickReplies();
+        } else {
+            alert(`Failed to save button: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error saving quick reply:', error);
+        alert('Error saving quick reply');
+    }
+}
+
+async function deleteQuickReply(row, reply) {
+    if (!reply) {
+        row.remove();
+        return;
+    }
+    if (!confirm(`Delete "${reply.label}"?`)) return;
+
+    try {
+        const response = await fetch(`/api/quick-replies/${reply.id}`, {
+            method: 'DELETE',
+        });
+
+        if (response.ok) {
+            row.remove();
+        } else {
+            alert('Failed to delete button');
+        }
+    } catch (error) {
+        console.error('Error deleting quick reply:', error);
+        alert('Error deleting quick reply');
+    }
+}
+
+async function openProducts() {
+    try {
+        await loadProducts();
+        editProduct(products.length > 0 ? products[0] : null);
+        productsModal.classList.add('active');
+    } catch (error) {
+        console.error('Error loading products:', error);
+        alert('Error loading products');
+    }
+}
+
+async function loadProducts() {
+    const response = await fetch('/api/products');
+    if (!response.ok) {
+        throw new Error(`HTTP ${response.status}`);
+    }
+    products = (await response.json()) || [];
+    renderProducts();
+}
+
+function editProduct(product) {
+    currentProduct = product;
+    productNameInput.value = product ? product.name : '';
+    productUnitInput.value = product ? product.unit : 'bungkus';
+    productEnabledInput.checked = product ? product.enabled : true;
+    productAliasesInput.value = product ? product.aliases : '';
+    productPriceInput.value = product ? product.base_price : '';
+    tiersList.innerHTML = '';
+    (product ? product.tiers : []).forEach(addTierRow);
+    deleteProductBtn.style.display = product ? '' : 'none';
+    quoteQuantityInput.value = '';
+    quoteResult.textContent = '';
+    renderProducts();
+}
+
+function addTierRow(tier) {
+    const row = document.createElement('div');
+    row.className = 'tier-row';
+    row.innerHTML = `
+        <input class="form-input tier-min" type="number" min="2" placeholder="From quantity" value="${tier.min_quantity}">
+        <input class="form-input tier-price" type="number" min="1" placeholder="Unit price (Rp)" value="${tier.unit_price}">
+        <button class="btn btn-danger">&times;</button>
+    `;
+    row.querySelector('button').addEventListener('click', () => row.remove());
+    tiersList.appendChild(row);
+}
+
+function readProductForm() {
+    const tiers = [];
+    tiersList.querySelectorAll('.tier-row').forEach(row => {
+        const min = parseInt(row.querySelector('.tier-min').value);
+        const price = parseInt(row.querySelector('.tier-price').value);
+        if (min && price) {
+            tiers.push({ min_quantity: min, unit_price: price });
+        }
+    });
+
+    return {
+        name: productNameInput.value.trim(),
+        unit: productUnitInput.value.trim(),
+        enabled: productEnabledInput.checked,
+        aliases: productAliasesInput.value.trim(),
+        base_price: parseInt(productPriceInput.value) || 0,
+        tiers,
+    };
+}
+
+async function saveProduct() {
+    const payload = readProductForm();
+    if (!payload.name || !payload.base_price) {
+        alert('Name and base price are required');
+        return;
+    }
+
+    const url = currentProduct ? `/api/products/${currentProduct.id}` : '/api/products';
+
+    try {
+        const response = await fetch(url, {
+            method: currentProduct ? 'PUT' : 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(payload),
+        });
+
+        if (response.ok) {
+            const saved = await response.json();
+            await loadProducts();
+            editProduct(products.find(p => p.id === saved.id) || null);
+        } else {
+            alert(`Failed to save product: ${await response.text()}`);
+        }
+    } catch (error) {
+        console.error('Error saving product:', error);
+        alert('Error saving product');
+    }
+}
+
+async function deleteProduct() {
+    if (!currentProduct) return;
+    if (!confirm(`Delete "${currentProduct.name}"?`)) return;
+
+    try {
+        const response = await fetch(`/api/products/${currentProduct.id}`, {
+            method: 'DELETE',
+        });
+
+        if (response.ok) {
+            await loadProducts();
+            editProduct(products.length > 0 ? products[0] : null);
+        } else {
+            alert('Failed to delete product');
+        }
+    } catch (error) {
+        console.error('Error deleting product:', error);
+        alert('Error deleting product');
+    }
+}
+
+async function updateQuotePreview() {
+    const quantity = parseInt(quoteQuantityInput.value);
+    if (!currentProduct || !quantity) {
+        quoteResult.textContent = '';
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/products/${currentProduct.id}/quote?quantity=${quantity}`);
+        const quote = await response.json();
+        quoteResult.textContent = `${quote.quantity} ${quote.unit} x ${formatRupiah(quote.unit_price)} = ${formatRupiah(quote.total)} (saved prices)`;
+    } catch (error) {
+        console.error('Error loading quote:', error);
+    }
+}
+
 // Rendering
 function renderConversations() {
     if (conversations.length === 0) {
@@ -190,6 +1167,7 @@ function renderConversations() {
 
     conversationsList.innerHTML = conversations.map(conv => {
         const isActive = currentConversation && currentConversation.id === conv.id;
+        const agentLabel = conv.assigned_agent ? `<span class="agent-badge">${escapeHtml(conv.assigned_agent)}</span>` : '';
         const statusLabel = conv.is_bot_active ? 'Bot Active' : 'Admin Mode';
         const statusClass = conv.is_bot_active ? '' : 'inactive';
         const displayName = conv.telegram_first_name || conv.telegram_username || 'User';
@@ -198,10 +1176,11 @@ function renderConversations() {
         return `
             <div class="conversation-item ${isActive ? 'active' : ''}" data-id="${conv.id}">
                 <div class="conversation-name">
-                    ${displayName}
+                    ${escapeHtml(displayName)}
                     <span class="bot-status ${statusClass}">${statusLabel}</span>
+                    ${agentLabel}
                 </div>
-                <div class="conversation-preview">${conv.last_message || 'No messages yet'}</div>
+                <div class="conversation-preview">${escapeHtml(conv.last_message || 'No messages yet')}</div>
                 <div class="conversation-time">${formatTime(conv.last_message_time || conv.created_at)}</div>
             </div>
         `;
@@ -216,6 +1195,121 @@ function renderConversations() {
     });
 }
 
+function renderDocuments() {
+    if (kbDocuments.length === 0) {
+        documentsList.innerHTML = '<div class="loading">No documents yet</div>';
+        return;
+    }
+
+    documentsList.innerHTML = kbDocuments.map(doc => {
+        const isActive = currentDocument && currentDocument.id === doc.id;
+
+        return `
+            <div class="document-item ${isActive ? 'active' : ''} ${doc.enabled ? '' : 'disabled'}" data-id="${doc.id}">
+                <div class="document-title">${escapeHtml(doc.title)}</div>
+                <div class="document-category">${escapeHtml(doc.category || 'Uncategorized')}</div>
+            </div>
+        `;
+    }).join('');
+
+    documentsList.querySelectorAll('.document-item').forEach(item => {
+        item.addEventListener('click', () => {
+            const id = parseInt(item.dataset.id);
+            editDocument(kbDocuments.find(d => d.id === id));
+        });
+    });
+}
+
+function renderRevisions() {
+    if (revisions.length === 0) {
+        revisionsList.innerHTML = '<div class="loading">No revisions yet</div>';
+        return;
+    }
+
+    revisionsList.innerHTML = revisions.map(rev => {
+        const isActive = currentRevision && currentRevision.id === rev.id;
+
+        return `
+            <div class="document-item ${isActive ? 'active' : ''}" data-id="${rev.id}">
+                <div class="document-title">#${rev.id} ${escapeHtml(rev.action)}</div>
+                <div class="document-category">${escapeHtml(rev.author || 'unknown')} &middot; ${formatTime(rev.created_at)}</div>
+            </div>
+        `;
+    }).join('');
+
+    revisionsList.querySelectorAll('.document-item').forEach(item => {
+        item.addEventListener('click', () => {
+            const id = parseInt(item.dataset.id);
+            showRevision(revisions.find(r => r.id === id));
+        });
+    });
+}
+
+function renderOrders() {
+    if (orders.length === 0) {
+        ordersList.innerHTML = '<div class="loading">No orders yet</div>';
+        return;
+    }
+
+    const statuses = ['pending', 'confirmed', 'completed', 'cancelled'];
+
+    ordersList.innerHTML = orders.map(order => {
+        const customer = order.telegram_first_name || order.telegram_username || 'Unknown';
+        const lines = order.items.map(item =>
+            `${item.quantity} ${item.unit} ${item.product_name} x ${formatRupiah(item.unit_price)} = ${formatRupiah(item.total)}`
+        ).join('\n');
+
+        return `
+            <div class="order-item">
+                <div class="order-header">
+                    <div>
+                        <span class="order-title">#${order.id} ${escapeHtml(customer)}</span>
+                        <span class="order-meta">${formatTime(order.created_at)}</span>
+                    </div>
+                    <span class="order-status ${order.status}">${order.status}</span>
+                </div>
+                <div class="order-lines">${escapeHtml(lines)}</div>
+                ${order.notes ? `<div class="order-meta">Notes: ${escapeHtml(order.notes)}</div>` : ''}
+                <div class="order-header">
+                    <strong>Total ${formatRupiah(order.total)}</strong>
+                    <select class="form-input order-status-select" data-id="${order.id}">
+                        ${statuses.map(s => `<option value="${s}" ${s === order.status ? 'selected' : ''}>${s}</option>`).join('')}
+                    </select>
+                </div>
+            </div>
+        `;
+    }).join('');
+
+    ordersList.querySelectorAll('.order-status-select').forEach(select => {
+        select.addEventListener('change', () => setOrderStatus(parseInt(select.dataset.id), select.value));
+    });
+}
+
+function renderProducts() {
+    if (products.length === 0) {
+        productsList.innerHTML = '<div class="loading">No products yet</div>';
+        return;
+    }
+
+    productsList.innerHTML = products.map(product => {
+        const isActive = currentProduct && currentProduct.id === product.id;
+
+        return `
+            <div class="document-item ${isActive ? 'active' : ''} ${product.enabled ? '' : 'disabled'}" data-id="${product.id}">
+                <div class="document-title">${escapeHtml(product.name)}</div>
+                <div class="document-category">${formatRupiah(product.base_price)} / ${escapeHtml(product.unit)}</div>
+            </div>
+        `;
+    }).join('');
+
+    productsList.querySelectorAll('.document-item').forEach(item => {
+        item.addEventListener('click', () => {
+            const id = parseInt(item.dataset.id);
+            editProduct(products.find(p => p.id === id));
+        });
+    });
+}
+
 function selectConversation(id) {
     currentConversation = conversations.find(c => c.id === id);
     if (!currentConversation) return;
@@ -242,6 +1336,26 @@ function updateToggleButton() {
         toggleBotBtn.textContent = 'Activate Bot';
         toggleBotBtn.className = 'btn btn-secondary';
     }
+
+    // The takeover timeout only matters while the bot is paused
+    const timeout = currentConversation.takeover_timeout;
+    takeoverTimeout.value = timeout === null || timeout === undefined ? '' : String(timeout);
+    if (takeoverTimeout.value === '' && timeout !== null && timeout !== undefined) {
+        takeoverTimeout.add(new Option(`Auto-resume: ${timeout} min`, String(timeout)));
+        takeoverTimeout.value = String(timeout);
+    }
+    takeoverTimeout.style.display = hasRole('agent') && !currentConversation.is_bot_active ? '' : 'none';
+
+    const agent = currentConversation.assigned_agent;
+    const mine = me && agent === me.username;
+    chatAssignee.textContent = agent ? `· Assigned to ${mine ? 'you' : agent}` : '· Unassigned';
+
+    // Agents can claim free chats and release or transfer their own; owners can reassign any
+    const canAct = hasRole('agent');
+    const canReassign = canAct && (!agent || mine || hasRole('owner'));
+    claimBtn.style.display = canAct && !agent ? '' : 'none';
+    releaseBtn.style.display = canReassign && agent ? '' : 'none';
+    transferBtn.style.display = canReassign ? '' : 'none';
 }
 
 function renderMessages() {
@@ -250,20 +1364,63 @@ function renderMessages() {
         return;
     }
 
-    messagesContainer.innerHTML = messages.map(msg => {
-        const senderLabel = msg.sender_type === 'admin' ? 'Admin' : msg.sender_type === 'bot' ? 'Bot' : '';
+    // Show button presses and other events between messages; on equal timestamps the event comes first
+    // because it usually triggered the message
+    const timeline = [
+        ...events.map(event => ({ kind: 'event', time: new Date(event.created_at), item: event })),
+        ...messages.map(msg => ({ kind: 'message', time: new Date(msg.created_at), item: msg })),
+    ].sort((a, b) => a.time - b.time);
+
+    messagesContainer.innerHTML = timeline.map(entry => {
+        if (entry.kind === 'event') {
+            return `<div class="message-event">${escapeHtml(formatEvent(entry.item))} · ${formatTime(entry.item.created_at)}</div>`;
+        }
+
+        const msg = entry.item;
+        const senderLabel = msg.sender_type === 'admin' ? (msg.sent_by ? `Admin · ${escapeHtml(msg.sent_by)}` : 'Admin')
+            : msg.sender_type === 'bot' ? 'Bot' : '';
 
         return `
             <div class="message ${msg.sender_type}">
                 ${msg.sender_type !== 'user' ? `<div class="message-sender">${senderLabel}</div>` : ''}
-                <div class="message-text">${escapeHtml(msg.message_text)}</div>
+                ${(msg.attachments || []).map(renderAttachment).join('')}
+                ${msg.message_text ? `<div class="message-text">${escapeHtml(msg.message_text)}</div>` : ''}
                 <div class="message-time">${formatTime(msg.created_at)}</div>
+                ${msg.audit ? `<div class="message-audit">${escapeHtml(formatAudit(msg.audit))}</div>` : ''}
             </div>
         `;
     }).join('');
 }
 
+function renderAttachment(att) {
+    const url = `/api/attachments/${att.id}/file`;
+
+    switch (att.kind) {
+        case 'photo':
+            return `<a class="attachment" href="${url}" target="_blank"><img src="${url}" loading="lazy" alt="Photo"></a>`;
+        case 'sticker':
+            if (att.mime_type === 'image/webp') {
+                return `<div class="attachment"><img class="sticker" src="${url}" loading="lazy" alt="${escapeHtml(att.emoji)}"></div>`;
+            }
+            return `<div class="attachment sticker-emoji">${escapeHtml(att.emoji || 'Sticker')}</div>`;
+        case 'voice':
+        case 'audio':
+            return `<div class="attachment"><audio controls preload="none" src="${url}"></audio>${att.transcript ? `<div class="attachment-transcript">${escapeHtml(att.transcript)}</div>` : ''}</div>`;
+        case 'video':
+            return `<div class="attachment"><video controls preload="none" src="${url}"></video></div>`;
+        default:
+            return `<a class="attachment attachment-file" href="${url}" target="_blank">📄 ${escapeHtml(att.file_name || 'Document')} <span>${formatFileSize(att.file_size)}</span></a>`;
+    }
+}
+
 // Helpers
+function formatFileSize(bytes) {
+    if (!bytes) return '';
+    if (bytes < 1024) return `${bytes} B`;
+    if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+    return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+}
+
 function formatTime(dateStr) {
     const date = new Date(dateStr);
     const now = new Date();
@@ -282,6 +1439,30 @@ function formatTime(dateStr) {
     return date.toLocaleDateString();
 }
 
+function formatAudit(audit) {
+    const parts = [];
+    if (audit.model) parts.push(audit.model);
+    parts.push(`prompt ${audit.prompt_version}`);
+    if (audit.kb_revision_id) parts.push(`KB rev #${audit.kb_revision_id}`);
+    if (audit.total_tokens) parts.push(`${audit.total_tokens} tokens (${audit.prompt_tokens}+${audit.completion_tokens})`);
+    parts.push(`${audit.latency_ms} ms`);
+    return parts.join(' · ');
+}
+
+function formatEvent(event) {
+    if (event.type === 'button_press') {
+        return `Customer pressed "${event.label}"`;
+    }
+    if (event.type === 'handoff') {
+        return `Handed to a human: ${event.label}`;
+    }
+    return event.label || event.type;
+}
+
+function formatRupiah(amount) {
+    return 'Rp' + Number(amount).toLocaleString('id-ID');
+}
+
 function escapeHtml(text) {
     const div = document.createElement('div');
     div.textContent = text;